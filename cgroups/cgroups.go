@@ -0,0 +1,96 @@
+package cgroups
+
+import (
+	"github.com/fromanirh/procwatch/procfs"
+
+	"bufio"
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrMalformedEntry = errors.New("malformed cgroup entry")
+	ErrNotFound       = errors.New("cgroup not found")
+)
+
+// Root is where the cgroup filesystems are mounted.
+var Root = "/sys/fs/cgroup"
+
+// Entry is a line of /proc/<pid>/cgroup. Per cgroups(7):
+// hierarchy-ID:controller-list:cgroup-path
+type Entry struct {
+	ID          int
+	Controllers []string
+	Path        string
+}
+
+// IsUnified tells if the entry belongs to the cgroup v2 hierarchy.
+func (e Entry) IsUnified() bool {
+	return e.ID == 0 && len(e.Controllers) == 0
+}
+
+func ReadProcCGroups(pid int32) ([]Entry, error) {
+	content, err := ioutil.ReadFile(procfs.PidPath(pid, "cgroup"))
+	if err != nil {
+		return nil, err
+	}
+	return ParseProcCGroups(content)
+}
+
+func ParseProcCGroups(content []byte) ([]Entry, error) {
+	var entries []Entry
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		fields := strings.SplitN(line, ":", 3)
+		if len(fields) != 3 {
+			return nil, ErrMalformedEntry
+		}
+		id, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return nil, ErrMalformedEntry
+		}
+		entry := Entry{
+			ID:   id,
+			Path: fields[2],
+		}
+		if fields[1] != "" {
+			entry.Controllers = strings.Split(fields[1], ",")
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// UnifiedDir returns the directory of the cgroup v2 the entries belong to.
+// Processes in the root cgroup are reported as not found, because the
+// root cgroup does not expose the per-cgroup accounting files.
+func UnifiedDir(entries []Entry) (string, error) {
+	for _, entry := range entries {
+		if !entry.IsUnified() {
+			continue
+		}
+		if entry.Path == "/" {
+			return "", ErrNotFound
+		}
+		return filepath.Join(unifiedRoot(), entry.Path), nil
+	}
+	return "", ErrNotFound
+}
+
+func unifiedRoot() string {
+	// pure cgroup v2 mounts the unified hierarchy on the root, hybrid setups
+	// mount it below.
+	if _, err := os.Stat(filepath.Join(Root, "cgroup.controllers")); err == nil {
+		return Root
+	}
+	return filepath.Join(Root, "unified")
+}
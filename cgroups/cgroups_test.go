@@ -0,0 +1,80 @@
+package cgroups
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func readTestData(t *testing.T, name string) []byte {
+	content, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return content
+}
+
+func TestParseProcCGroupsV1(t *testing.T) {
+	entries, err := ParseProcCGroups(readTestData(t, "cgroup-v1"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(entries) != 11 {
+		t.Errorf("unexpected entries: %d", len(entries))
+	}
+	if entries[4].ID != 7 || len(entries[4].Controllers) != 2 || entries[4].Controllers[1] != "cpu" {
+		t.Errorf("unexpected entry: %#v", entries[4])
+	}
+	if _, err := UnifiedDir(entries); err != ErrNotFound {
+		t.Errorf("unexpected unified cgroup: %v", err)
+	}
+}
+
+func TestParseProcCGroupsV2(t *testing.T) {
+	oldRoot := Root
+	Root = "/sys/fs/cgroup"
+	defer func() { Root = oldRoot }()
+	entries, err := ParseProcCGroups(readTestData(t, "cgroup-v2"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(entries) != 1 || !entries[0].IsUnified() {
+		t.Fatalf("unexpected entries: %#v", entries)
+	}
+	dir, err := UnifiedDir(entries)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if filepath.Base(dir) != "crio-7d8e5b.scope" {
+		t.Errorf("unexpected dir: %v", dir)
+	}
+}
+
+func TestUnifiedDirRoot(t *testing.T) {
+	entries := []Entry{{ID: 0, Path: "/"}}
+	if _, err := UnifiedDir(entries); err != ErrNotFound {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestParsePressure(t *testing.T) {
+	pr, err := ParsePressure(readTestData(t, "memory.pressure"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	some := PressureStat{Avg10: 1.53, Avg60: 0.87, Avg300: 0.25, Total: 10273629}
+	if pr.Some != some {
+		t.Errorf("unexpected some: %#v", pr.Some)
+	}
+	if pr.Full == nil || pr.Full.Total != 3312745 {
+		t.Errorf("unexpected full: %#v", pr.Full)
+	}
+
+	pr, err = ParsePressure([]byte("some avg10=0.00 avg60=0.00 avg300=0.00 total=0\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if pr.Full != nil {
+		t.Errorf("unexpected full: %#v", pr.Full)
+	}
+}
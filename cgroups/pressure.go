@@ -0,0 +1,88 @@
+package cgroups
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// PressureStat is a line of a PSI file. Averages are percentages,
+// total is the cumulative stall time in microseconds.
+type PressureStat struct {
+	Avg10  float64
+	Avg60  float64
+	Avg300 float64
+	Total  uint64
+}
+
+type Pressure struct {
+	Some PressureStat
+	Full *PressureStat
+}
+
+// ReadPressure reads the PSI of the given resource ("cpu", "memory", "io")
+// from the given cgroup directory.
+func ReadPressure(dir, resource string) (Pressure, error) {
+	content, err := ioutil.ReadFile(filepath.Join(dir, resource+".pressure"))
+	if err != nil {
+		return Pressure{}, err
+	}
+	return ParsePressure(content)
+}
+
+func ParsePressure(content []byte) (Pressure, error) {
+	var pr Pressure
+	found := false
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		ps, err := parsePressureStat(fields[1:])
+		if err != nil {
+			return pr, err
+		}
+		switch fields[0] {
+		case "some":
+			pr.Some = ps
+			found = true
+		case "full":
+			pr.Full = &ps
+		default:
+			return pr, ErrMalformedEntry
+		}
+	}
+	if !found {
+		return pr, ErrMalformedEntry
+	}
+	return pr, scanner.Err()
+}
+
+func parsePressureStat(fields []string) (PressureStat, error) {
+	var ps PressureStat
+	var err error
+	for _, field := range fields {
+		items := strings.SplitN(field, "=", 2)
+		if len(items) != 2 {
+			return ps, ErrMalformedEntry
+		}
+		switch items[0] {
+		case "avg10":
+			ps.Avg10, err = strconv.ParseFloat(items[1], 64)
+		case "avg60":
+			ps.Avg60, err = strconv.ParseFloat(items[1], 64)
+		case "avg300":
+			ps.Avg300, err = strconv.ParseFloat(items[1], 64)
+		case "total":
+			ps.Total, err = strconv.ParseUint(items[1], 10, 64)
+		}
+		if err != nil {
+			return ps, ErrMalformedEntry
+		}
+	}
+	return ps, nil
+}
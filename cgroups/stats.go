@@ -0,0 +1,294 @@
+package cgroups
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Unlimited is the value reported for limits which are not set.
+const Unlimited = ^uint64(0)
+
+// v1Unlimited is the lowest value cgroup v1 reports for limits which are
+// not set: the max int64 rounded down to the page size, 64KiB at most.
+const v1Unlimited = uint64(math.MaxInt64) &^ (64<<10 - 1)
+
+type CPUStats struct {
+	UsageUsec         uint64
+	Periods           uint64
+	ThrottledPeriods  uint64
+	ThrottledTimeUsec uint64
+}
+
+// MemoryStats reports sizes in bytes.
+type MemoryStats struct {
+	Current uint64
+	Max     uint64
+	// OOM is only available on v2
+	OOM     uint64
+	OOMKill uint64
+}
+
+type IOStats struct {
+	ReadBytes  uint64
+	WriteBytes uint64
+	ReadIOs    uint64
+	WriteIOs   uint64
+}
+
+// Stats is the resource accounting of a cgroup. Values missing because the
+// controller is not enabled are reported as zero (as Unlimited for limits).
+type Stats struct {
+	Version int
+	CPU     CPUStats
+	Memory  MemoryStats
+	IO      IOStats
+}
+
+// ReadStats reads the accounting of the cgroup the entries point to,
+// from either the v1 controllers or the v2 unified hierarchy.
+func ReadStats(entries []Entry) (Stats, error) {
+	if len(entries) == 1 && entries[0].IsUnified() {
+		dir, err := UnifiedDir(entries)
+		if err != nil {
+			return Stats{}, err
+		}
+		return readStatsV2(dir)
+	}
+	return readStatsV1(entries)
+}
+
+// ControllerDir returns the directory of the cgroup v1 the entries belong
+// to for the given controller.
+func ControllerDir(entries []Entry, controller string) (string, error) {
+	for _, entry := range entries {
+		for _, ctrl := range entry.Controllers {
+			if ctrl == controller {
+				return filepath.Join(Root, controller, entry.Path), nil
+			}
+		}
+	}
+	return "", ErrNotFound
+}
+
+func readStatsV2(dir string) (Stats, error) {
+	st := Stats{
+		Version: 2,
+		Memory:  MemoryStats{Max: Unlimited},
+	}
+
+	cpuStat, err := readFlatKeyed(filepath.Join(dir, "cpu.stat"))
+	if err != nil {
+		return st, err
+	}
+	st.CPU = CPUStats{
+		UsageUsec:         cpuStat["usage_usec"],
+		Periods:           cpuStat["nr_periods"],
+		ThrottledPeriods:  cpuStat["nr_throttled"],
+		ThrottledTimeUsec: cpuStat["throttled_usec"],
+	}
+
+	st.Memory.Current, err = readValue(filepath.Join(dir, "memory.current"))
+	if err != nil {
+		return st, err
+	}
+	st.Memory.Max, err = readValue(filepath.Join(dir, "memory.max"))
+	if err != nil {
+		return st, err
+	}
+	memEvents, err := readFlatKeyed(filepath.Join(dir, "memory.events"))
+	if err != nil {
+		return st, err
+	}
+	st.Memory.OOM = memEvents["oom"]
+	st.Memory.OOMKill = memEvents["oom_kill"]
+
+	ioStat, err := readNestedKeyed(filepath.Join(dir, "io.stat"))
+	if err != nil {
+		return st, err
+	}
+	st.IO = IOStats{
+		ReadBytes:  ioStat["rbytes"],
+		WriteBytes: ioStat["wbytes"],
+		ReadIOs:    ioStat["rios"],
+		WriteIOs:   ioStat["wios"],
+	}
+	return st, nil
+}
+
+func readStatsV1(entries []Entry) (Stats, error) {
+	st := Stats{
+		Version: 1,
+		Memory:  MemoryStats{Max: Unlimited},
+	}
+
+	if dir, err := ControllerDir(entries, "cpu"); err == nil {
+		cpuStat, err := readFlatKeyed(filepath.Join(dir, "cpu.stat"))
+		if err != nil {
+			return st, err
+		}
+		st.CPU.Periods = cpuStat["nr_periods"]
+		st.CPU.ThrottledPeriods = cpuStat["nr_throttled"]
+		st.CPU.ThrottledTimeUsec = cpuStat["throttled_time"] / 1000
+	}
+	if dir, err := ControllerDir(entries, "cpuacct"); err == nil {
+		usage, err := readValue(filepath.Join(dir, "cpuacct.usage"))
+		if err != nil {
+			return st, err
+		}
+		st.CPU.UsageUsec = usage / 1000
+	}
+
+	if dir, err := ControllerDir(entries, "memory"); err == nil {
+		var err error
+		st.Memory.Current, err = readValue(filepath.Join(dir, "memory.usage_in_bytes"))
+		if err != nil {
+			return st, err
+		}
+		st.Memory.Max, err = readValue(filepath.Join(dir, "memory.limit_in_bytes"))
+		if err != nil {
+			return st, err
+		}
+		oomControl, err := readFlatKeyed(filepath.Join(dir, "memory.oom_control"))
+		if err != nil {
+			return st, err
+		}
+		st.Memory.OOMKill = oomControl["oom_kill"]
+	}
+
+	if dir, err := ControllerDir(entries, "blkio"); err == nil {
+		sizes, err := readBlkio(filepath.Join(dir, "blkio.throttle.io_service_bytes"))
+		if err != nil {
+			return st, err
+		}
+		ios, err := readBlkio(filepath.Join(dir, "blkio.throttle.io_serviced"))
+		if err != nil {
+			return st, err
+		}
+		st.IO = IOStats{
+			ReadBytes:  sizes["Read"],
+			WriteBytes: sizes["Write"],
+			ReadIOs:    ios["Read"],
+			WriteIOs:   ios["Write"],
+		}
+	}
+	return st, nil
+}
+
+func readContent(path string) ([]byte, error) {
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return content, err
+}
+
+// readValue reads a single value file. Missing files, "max" and the huge
+// values v1 uses for no limit are reported as Unlimited.
+func readValue(path string) (uint64, error) {
+	content, err := readContent(path)
+	if err != nil {
+		return 0, err
+	}
+	value := strings.TrimSpace(string(content))
+	if value == "" || value == "max" {
+		return Unlimited, nil
+	}
+	val, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, ErrMalformedEntry
+	}
+	if val >= v1Unlimited {
+		return Unlimited, nil
+	}
+	return val, nil
+}
+
+// readFlatKeyed reads "key value" lines, like cpu.stat
+func readFlatKeyed(path string) (map[string]uint64, error) {
+	content, err := readContent(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseFlatKeyed(content)
+}
+
+func parseFlatKeyed(content []byte) (map[string]uint64, error) {
+	vals := make(map[string]uint64)
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		val, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return nil, ErrMalformedEntry
+		}
+		vals[fields[0]] = val
+	}
+	return vals, scanner.Err()
+}
+
+// readNestedKeyed reads "device key=value..." lines, like io.stat,
+// summing the values across all the devices.
+func readNestedKeyed(path string) (map[string]uint64, error) {
+	content, err := readContent(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseNestedKeyed(content)
+}
+
+func parseNestedKeyed(content []byte) (map[string]uint64, error) {
+	vals := make(map[string]uint64)
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		for _, field := range fields[1:] {
+			items := strings.SplitN(field, "=", 2)
+			if len(items) != 2 {
+				continue
+			}
+			val, err := strconv.ParseUint(items[1], 10, 64)
+			if err != nil {
+				return nil, ErrMalformedEntry
+			}
+			vals[items[0]] += val
+		}
+	}
+	return vals, scanner.Err()
+}
+
+// readBlkio reads the blkio v1 "device operation value" lines, summing
+// the values across all the devices.
+func readBlkio(path string) (map[string]uint64, error) {
+	content, err := readContent(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseBlkio(content)
+}
+
+func parseBlkio(content []byte) (map[string]uint64, error) {
+	vals := make(map[string]uint64)
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		// skip the "Total" summary line
+		if len(fields) != 3 {
+			continue
+		}
+		val, err := strconv.ParseUint(fields[2], 10, 64)
+		if err != nil {
+			return nil, ErrMalformedEntry
+		}
+		vals[fields[1]] += val
+	}
+	return vals, scanner.Err()
+}
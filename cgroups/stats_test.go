@@ -0,0 +1,114 @@
+package cgroups
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+}
+
+func TestReadStatsV2(t *testing.T) {
+	root, err := ioutil.TempDir("", "cgroups")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(root)
+	oldRoot := Root
+	Root = root
+	defer func() { Root = oldRoot }()
+
+	writeFiles(t, root, map[string]string{
+		"cgroup.controllers":     "cpu io memory pids\n",
+		"pod/ctr/cpu.stat":       "usage_usec 2000\nuser_usec 1500\nsystem_usec 500\nnr_periods 10\nnr_throttled 3\nthrottled_usec 750\n",
+		"pod/ctr/memory.current": "4096\n",
+		"pod/ctr/memory.max":     "max\n",
+		"pod/ctr/memory.events":  "low 0\nhigh 0\nmax 4\noom 2\noom_kill 1\n",
+		"pod/ctr/io.stat":        "8:0 rbytes=100 wbytes=200 rios=1 wios=2 dbytes=0 dios=0\n8:16 rbytes=10 wbytes=20 rios=3 wios=4 dbytes=0 dios=0\n",
+	})
+
+	st, err := ReadStats([]Entry{{ID: 0, Path: "/pod/ctr"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := Stats{
+		Version: 2,
+		CPU:     CPUStats{UsageUsec: 2000, Periods: 10, ThrottledPeriods: 3, ThrottledTimeUsec: 750},
+		Memory:  MemoryStats{Current: 4096, Max: Unlimited, OOM: 2, OOMKill: 1},
+		IO:      IOStats{ReadBytes: 110, WriteBytes: 220, ReadIOs: 4, WriteIOs: 6},
+	}
+	if st != expected {
+		t.Errorf("mismatch:\ngot      %#v\nexpected %#v", st, expected)
+	}
+}
+
+func TestReadStatsV1(t *testing.T) {
+	root, err := ioutil.TempDir("", "cgroups")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(root)
+	oldRoot := Root
+	Root = root
+	defer func() { Root = oldRoot }()
+
+	writeFiles(t, root, map[string]string{
+		"cpu/pod/ctr/cpu.stat":                          "nr_periods 10\nnr_throttled 3\nthrottled_time 750000\n",
+		"cpuacct/pod/ctr/cpuacct.usage":                 "2000000\n",
+		"memory/pod/ctr/memory.usage_in_bytes":          "4096\n",
+		"memory/pod/ctr/memory.limit_in_bytes":          "8192\n",
+		"memory/pod/ctr/memory.oom_control":             "oom_kill_disable 0\nunder_oom 0\noom_kill 1\n",
+		"blkio/pod/ctr/blkio.throttle.io_service_bytes": "8:0 Read 100\n8:0 Write 200\n8:0 Sync 0\n8:0 Async 300\n8:0 Total 300\nTotal 300\n",
+		"blkio/pod/ctr/blkio.throttle.io_serviced":      "8:0 Read 1\n8:0 Write 2\n8:0 Total 3\nTotal 3\n",
+	})
+
+	entries := []Entry{
+		{ID: 7, Controllers: []string{"cpuacct", "cpu"}, Path: "/pod/ctr"},
+		{ID: 6, Controllers: []string{"memory"}, Path: "/pod/ctr"},
+		{ID: 10, Controllers: []string{"blkio"}, Path: "/pod/ctr"},
+	}
+	st, err := ReadStats(entries)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := Stats{
+		Version: 1,
+		CPU:     CPUStats{UsageUsec: 2000, Periods: 10, ThrottledPeriods: 3, ThrottledTimeUsec: 750},
+		Memory:  MemoryStats{Current: 4096, Max: 8192, OOMKill: 1},
+		IO:      IOStats{ReadBytes: 100, WriteBytes: 200, ReadIOs: 1, WriteIOs: 2},
+	}
+	if st != expected {
+		t.Errorf("mismatch:\ngot      %#v\nexpected %#v", st, expected)
+	}
+}
+
+func TestReadValueV1Unlimited(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cgroups")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// 4KiB and 64KiB pages
+	for _, value := range []string{"9223372036854771712", "9223372036854710272"} {
+		writeFiles(t, dir, map[string]string{"memory.limit_in_bytes": value + "\n"})
+		val, err := readValue(filepath.Join(dir, "memory.limit_in_bytes"))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if val != Unlimited {
+			t.Errorf("mismatch: %s read as %d", value, val)
+		}
+	}
+}
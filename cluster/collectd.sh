@@ -3,4 +3,4 @@
 set -xe
 
 /usr/sbin/collectd -C /etc/collectd/collectd.conf
-/usr/sbin/procwatch -U /var/run/collectd.sock /etc/procwatch.json
+/usr/sbin/procwatch -U /var/run/collectd.sock -A 127.0.0.1:9092 /etc/procwatch.json
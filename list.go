@@ -0,0 +1,179 @@
+package main
+
+import (
+	"github.com/fromanirh/procwatch/cgroups"
+	"github.com/fromanirh/procwatch/podfind"
+	"github.com/fromanirh/procwatch/procfind"
+	"github.com/fromanirh/procwatch/procfs"
+	"github.com/fromanirh/procwatch/procnotify"
+	flag "github.com/spf13/pflag"
+
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// listTarget collects what a scan finds for a target: the processes
+// matching its argv, and the ones matching just its first element.
+type listTarget struct {
+	conf   procnotify.Config
+	pids   []procfind.Pid
+	misses []procfind.Pid
+}
+
+func (lt *listTarget) AddPid(p procfind.Pid) {
+	lt.pids = append(lt.pids, p)
+}
+
+type nearMiss struct {
+	lt *listTarget
+}
+
+func (nm nearMiss) AddPid(p procfind.Pid) {
+	nm.lt.misses = append(nm.lt.misses, p)
+}
+
+type lister struct {
+	targets []*listTarget
+}
+
+// MatchArgv matches like the Notifier does, but reports the near misses
+// too, as entries of their own.
+func (l *lister) MatchArgv(argv []string) (procfind.Entry, bool) {
+	for _, lt := range l.targets {
+		match, err := procfind.MatchArgv(argv, lt.conf.Argv)
+		if err != nil {
+			break
+		} else if match {
+			return lt, true
+		}
+	}
+	for _, lt := range l.targets {
+		match, err := procfind.MatchArgv(argv[:1], lt.conf.Argv[:1])
+		if err == nil && match {
+			return nearMiss{lt}, true
+		}
+	}
+	return nil, false
+}
+
+// runList implements the list subcommand: show which processes
+// the targets of a configuration match.
+func runList(args []string) int {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s list [options] /path/to/procwatch.json\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	noMisses := fs.BoolP("no-near-misses", "n", false, "don't report the processes matching only argv[0]")
+	err := fs.Parse(args)
+	if err != nil {
+		return 2
+	}
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return 2
+	}
+
+	conf := Config{}
+	err = readFile(&conf, fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error reading the configuration on '%s': %s\n", fs.Arg(0), err)
+		return 1
+	}
+
+	l := &lister{}
+	for _, target := range conf.Targets {
+		err = target.Validate()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid target configuration: %s\n", err)
+			return 1
+		}
+		if target.Name == "" {
+			target.Name = filepath.Base(target.Argv[0])
+		}
+		l.targets = append(l.targets, &listTarget{conf: target})
+	}
+
+	var pr *podfind.PodResolver
+	if conf.CRIEndPoint != "" {
+		pr, err = podfind.NewPodResolver(conf.CRIEndPoint, 10*time.Second)
+		if err == nil {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			err = pr.Update(ctx)
+			cancel()
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "pod resolution not available: %s\n", err)
+			pr = nil
+		}
+	}
+
+	st, err := procfind.Scan(l)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error scanning /proc: %s\n", err)
+		return 1
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "TARGET\tPID\tEXE\tCGROUP\tPOD\tARGV\n")
+	for _, lt := range l.targets {
+		if len(lt.pids) == 0 {
+			fmt.Fprintf(w, "%s\t-\t\t\t\t(no match for %s)\n", lt.conf.Name, strings.Join(lt.conf.Argv, " "))
+			continue
+		}
+		printPids(w, lt.conf.Name, lt.pids, pr)
+	}
+	if !*noMisses {
+		fmt.Fprintf(w, "\nNEAR MISS\tPID\tEXE\tCGROUP\tPOD\tARGV\n")
+		for _, lt := range l.targets {
+			printPids(w, lt.conf.Name, lt.misses, pr)
+		}
+	}
+	w.Flush()
+	fmt.Fprintf(os.Stderr, "scanned %d /proc entries in %v\n", st.Entries, st.Duration)
+	return 0
+}
+
+func printPids(w io.Writer, name string, pids []procfind.Pid, pr *podfind.PodResolver) {
+	sort.Slice(pids, func(i, j int) bool { return pids[i] < pids[j] })
+	for _, pid := range pids {
+		exe, err := os.Readlink(procfs.PidPath(int32(pid), "exe"))
+		if err != nil {
+			exe = "-"
+		}
+		cgroup := "-"
+		entries, err := cgroups.ReadProcCGroups(int32(pid))
+		if err == nil {
+			cgroup = cgroupPath(entries)
+		}
+		pod := "-"
+		if pr != nil {
+			if podName, err := pr.FindPodByPID(int32(pid)); err == nil {
+				pod = podName
+			}
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%s\n", name, pid, exe, cgroup, pod,
+			strings.Join(procfind.Argv(pid), " "))
+	}
+}
+
+// cgroupPath picks the most meaningful cgroup of a process: the v2 one,
+// or the one of the first v1 hierarchy listed.
+func cgroupPath(entries []cgroups.Entry) string {
+	for _, entry := range entries {
+		if entry.IsUnified() {
+			return entry.Path
+		}
+	}
+	if len(entries) > 0 {
+		return entries[0].Path
+	}
+	return "-"
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"github.com/fromanirh/procwatch/cgroups"
+	"github.com/fromanirh/procwatch/procfind"
+	"github.com/fromanirh/procwatch/procfs/procfstest"
+	"github.com/fromanirh/procwatch/procnotify"
+
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestListMatch(t *testing.T) {
+	fs := procfstest.New(t)
+	defer fs.Remove()
+	defer fs.Use()()
+
+	fs.Add(procfstest.Proc{Pid: 1, Argv: []string{"/usr/lib/systemd/systemd"}})
+	fs.Add(procfstest.Proc{
+		Pid:    2159,
+		PPid:   1,
+		Argv:   []string{"/usr/bin/python2", "/usr/share/vdsm/vdsmd"},
+		CGroup: "0::/system.slice/vdsmd.service\n",
+	})
+	fs.Add(procfstest.Proc{
+		Pid:    2300,
+		PPid:   1,
+		Argv:   []string{"/usr/bin/python2", "/usr/share/vdsm/supervdsmd"},
+		CGroup: "4:memory:/system.slice/supervdsmd.service\n1:name=systemd:/system.slice/supervdsmd.service\n",
+	})
+	fs.Add(procfstest.Proc{Pid: 2192, PPid: 1, Argv: []string{"/usr/libexec/qemu-kvm"}})
+
+	vdsm := &listTarget{conf: procnotify.Config{Name: "vdsm", Argv: []string{"/usr/bin/python2", "/usr/share/vdsm/vdsmd"}}}
+	l := &lister{targets: []*listTarget{vdsm}}
+	_, err := procfind.Scan(l)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(vdsm.pids, []procfind.Pid{2159}) {
+		t.Errorf("mismatch: pids %v", vdsm.pids)
+	}
+	// same interpreter, another script
+	if !reflect.DeepEqual(vdsm.misses, []procfind.Pid{2300}) {
+		t.Errorf("mismatch: near misses %v", vdsm.misses)
+	}
+
+	var buf bytes.Buffer
+	printPids(&buf, "vdsm", append(vdsm.pids, vdsm.misses...), nil)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("unexpected output: %q", lines)
+	}
+	expected := [][]string{
+		{"vdsm", "2159", "-", "/system.slice/vdsmd.service", "-", "/usr/bin/python2 /usr/share/vdsm/vdsmd"},
+		{"vdsm", "2300", "-", "/system.slice/supervdsmd.service", "-", "/usr/bin/python2 /usr/share/vdsm/supervdsmd"},
+	}
+	for i, line := range lines {
+		if fields := strings.Split(line, "\t"); !reflect.DeepEqual(fields, expected[i]) {
+			t.Errorf("mismatch: line %d %q expected %q", i, fields, expected[i])
+		}
+	}
+}
+
+func TestCGroupPath(t *testing.T) {
+	v1 := []cgroups.Entry{
+		{ID: 4, Controllers: []string{"memory"}, Path: "/user.slice"},
+		{ID: 1, Controllers: []string{"name=systemd"}, Path: "/user.slice/session-1.scope"},
+	}
+	hybrid := append(v1, cgroups.Entry{Path: "/user.slice/session-1.scope"})
+
+	testCases := []struct {
+		entries  []cgroups.Entry
+		expected string
+	}{
+		{v1, "/user.slice"},
+		{hybrid, "/user.slice/session-1.scope"},
+		{nil, "-"},
+	}
+	for _, tc := range testCases {
+		if got := cgroupPath(tc.entries); got != tc.expected {
+			t.Errorf("mismatch: %q expected %q", got, tc.expected)
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package podfind
 
 import (
+	"github.com/fromanirh/procwatch/procfs"
+	"github.com/fromanirh/procwatch/proclog"
 	"google.golang.org/grpc"
 	pb "k8s.io/kubernetes/pkg/kubelet/apis/cri/runtime/v1alpha2"
 	"k8s.io/kubernetes/pkg/kubelet/util"
@@ -13,25 +15,39 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 )
 
+var logger = proclog.New("podfind")
+
 func getAddressAndDialer(endpoint string) (string, func(addr string, timeout time.Duration) (net.Conn, error), error) {
 	return util.GetAddressAndDialer(endpoint)
 }
 
+// Stats reports how the calls to the CRI endpoint are doing.
+type Stats struct {
+	Calls  uint64
+	Errors uint64
+	// ContainersLatency and PodsLatency are the durations of the last
+	// ListContainers and ListPodSandbox calls
+	ContainersLatency time.Duration
+	PodsLatency       time.Duration
+}
+
 type PodResolver struct {
-	conn           *grpc.ClientConn
-	client         pb.RuntimeServiceClient
+	conn   *grpc.ClientConn
+	client pb.RuntimeServiceClient
+	// lock guards the maps, replaced as a whole by each Update
+	lock           sync.RWMutex
 	containerToPod map[string]string
 	podInfos       map[string]string
-	Debug          bool
+	statsLock      sync.Mutex
+	stats          Stats
 }
 
 func NewPodResolver(runtimeEndPoint string, timeout time.Duration) (*PodResolver, error) {
-	pr := &PodResolver{
-		Debug: true,
-	}
+	pr := &PodResolver{}
 
 	addr, dialer, err := getAddressAndDialer(runtimeEndPoint)
 	if err != nil {
@@ -47,16 +63,82 @@ func NewPodResolver(runtimeEndPoint string, timeout time.Duration) (*PodResolver
 	return pr, nil
 }
 
-func (pr *PodResolver) Update() error {
-	var err error
-	err = pr.updateInfoContainers()
+func (pr *PodResolver) Stats() Stats {
+	pr.statsLock.Lock()
+	defer pr.statsLock.Unlock()
+	return pr.stats
+}
+
+// observe accounts a call, storing its duration in latency, which must
+// point into pr.stats.
+func (pr *PodResolver) observe(latency *time.Duration, begin time.Time, err error) {
+	pr.statsLock.Lock()
+	defer pr.statsLock.Unlock()
+	pr.stats.Calls++
+	if err != nil {
+		pr.stats.Errors++
+	}
+	*latency = time.Since(begin)
+}
+
+// Listing is what the resolver learned from the CRI endpoint.
+type Listing struct {
+	// Containers maps the container IDs to the pod IDs
+	Containers map[string]string `json:"containers"`
+	// Pods maps the pod IDs to the pod names
+	Pods map[string]string `json:"pods"`
+}
+
+func (pr *PodResolver) Listing() Listing {
+	pr.lock.RLock()
+	defer pr.lock.RUnlock()
+	return Listing{
+		Containers: pr.containerToPod,
+		Pods:       pr.podInfos,
+	}
+}
+
+// NewStaticPodResolver creates a resolver which doesn't talk to any
+// CRI endpoint, and resolves the pods according to the given listing.
+func NewStaticPodResolver(l Listing) *PodResolver {
+	return &PodResolver{
+		containerToPod: l.Containers,
+		podInfos:       l.Pods,
+	}
+}
+
+// SetListing replaces what the resolver knows about the pods.
+func (pr *PodResolver) SetListing(l Listing) {
+	pr.lock.Lock()
+	defer pr.lock.Unlock()
+	pr.containerToPod = l.Containers
+	pr.podInfos = l.Pods
+}
+
+// Update asks the CRI endpoint for the running containers and the ready
+// pods. The lookups keep using the previous listing until both calls are
+// done; ctx bounds the calls.
+func (pr *PodResolver) Update(ctx context.Context) error {
+	if pr.client == nil {
+		// static resolver
+		return nil
+	}
+	containerToPod, err := pr.listContainers(ctx)
 	if err != nil {
 		return err
 	}
-	return pr.updateInfoPods()
+	podInfos, err := pr.listPods(ctx)
+	if err != nil {
+		return err
+	}
+	pr.lock.Lock()
+	defer pr.lock.Unlock()
+	pr.containerToPod = containerToPod
+	pr.podInfos = podInfos
+	return nil
 }
 
-func (pr *PodResolver) updateInfoContainers() error {
+func (pr *PodResolver) listContainers(ctx context.Context) (map[string]string, error) {
 	st := &pb.ContainerStateValue{}
 	st.State = pb.ContainerState_CONTAINER_RUNNING
 	filter := &pb.ContainerFilter{}
@@ -66,23 +148,23 @@ func (pr *PodResolver) updateInfoContainers() error {
 		Filter: filter,
 	}
 
-	r, err := pr.client.ListContainers(context.Background(), request)
+	begin := time.Now()
+	r, err := pr.client.ListContainers(ctx, request)
+	pr.observe(&pr.stats.ContainersLatency, begin, err)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	pr.containerToPod = make(map[string]string)
+	containerToPod := make(map[string]string)
 	for _, c := range r.GetContainers() {
-		pr.containerToPod[c.Id] = c.PodSandboxId
-		if pr.Debug {
-			fmt.Fprintf(os.Stderr, "CNT: %v -> %v\n", c.Id, pr.containerToPod[c.Id])
-		}
+		containerToPod[c.Id] = c.PodSandboxId
+		logger.Debug("container", "id", c.Id, "pod", c.PodSandboxId)
 	}
 
-	return nil
+	return containerToPod, nil
 }
 
-func (pr *PodResolver) updateInfoPods() error {
+func (pr *PodResolver) listPods(ctx context.Context) (map[string]string, error) {
 	st := &pb.PodSandboxStateValue{}
 	st.State = pb.PodSandboxState_SANDBOX_READY
 	filter := &pb.PodSandboxFilter{}
@@ -92,25 +174,25 @@ func (pr *PodResolver) updateInfoPods() error {
 		Filter: filter,
 	}
 
-	r, err := pr.client.ListPodSandbox(context.Background(), request)
+	begin := time.Now()
+	r, err := pr.client.ListPodSandbox(ctx, request)
+	pr.observe(&pr.stats.PodsLatency, begin, err)
 
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	pr.podInfos = make(map[string]string)
+	podInfos := make(map[string]string)
 	for _, p := range r.GetItems() {
 		if domainName, ok := p.Annotations["kubevirt.io/domain"]; ok {
-			pr.podInfos[p.Id] = domainName
+			podInfos[p.Id] = domainName
 		} else {
-			pr.podInfos[p.Id] = p.Metadata.Name
-		}
-		if pr.Debug {
-			fmt.Fprintf(os.Stderr, "POD: %v -> %v\n", p.Id, pr.podInfos[p.Id])
+			podInfos[p.Id] = p.Metadata.Name
 		}
+		logger.Debug("pod", "id", p.Id, "name", podInfos[p.Id])
 	}
 
-	return nil
+	return podInfos, nil
 }
 
 func (pr *PodResolver) FindPodByPID(pid int32) (string, error) {
@@ -118,6 +200,8 @@ func (pr *PodResolver) FindPodByPID(pid int32) (string, error) {
 	if cgroupStyle != DockerCGroup {
 		return "", errors.New(fmt.Sprintf("unsupported cgroup style: %v", cgroupStyle))
 	}
+	pr.lock.RLock()
+	defer pr.lock.RUnlock()
 	podId, ok := pr.containerToPod[containerId]
 	if !ok {
 		return "", errors.New(fmt.Sprintf("no POD found for pid %v on container %v", pid, containerId))
@@ -137,7 +221,7 @@ const (
 )
 
 func FindContainerIDByCGroup(pid int32) (string, int) {
-	return parseProcCGroupEntry(fmt.Sprintf("/proc/%d/cgroup", pid))
+	return parseProcCGroupEntry(procfs.PidPath(pid, "cgroup"))
 }
 
 func parseProcCGroupEntry(entry string) (string, int) {
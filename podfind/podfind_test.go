@@ -1,6 +1,14 @@
 package podfind
 
-import "testing"
+import (
+	"google.golang.org/grpc"
+	pb "k8s.io/kubernetes/pkg/kubelet/apis/cri/runtime/v1alpha2"
+
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
 
 func TestNoCgroupData(t *testing.T) {
 	containerID, cgroupStyle := parseProcCGroupEntry("/dev/null")
@@ -31,3 +39,57 @@ func TestEmptyDockerData(t *testing.T) {
 		t.Errorf("unexpected cgroupStyle: %v", cgroupStyle)
 	}
 }
+
+// fakeRuntime answers the listings, or blocks until the caller gives up
+// if wedged is set.
+type fakeRuntime struct {
+	pb.RuntimeServiceClient
+	wedged bool
+}
+
+func (fr *fakeRuntime) ListContainers(ctx context.Context, in *pb.ListContainersRequest, opts ...grpc.CallOption) (*pb.ListContainersResponse, error) {
+	if fr.wedged {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return &pb.ListContainersResponse{
+		Containers: []*pb.Container{{Id: "0123456789ab", PodSandboxId: "pod0"}},
+	}, nil
+}
+
+func (fr *fakeRuntime) ListPodSandbox(ctx context.Context, in *pb.ListPodSandboxRequest, opts ...grpc.CallOption) (*pb.ListPodSandboxResponse, error) {
+	return &pb.ListPodSandboxResponse{
+		Items: []*pb.PodSandbox{{Id: "pod0", Metadata: &pb.PodSandboxMetadata{Name: "virt-launcher"}}},
+	}, nil
+}
+
+func TestUpdateDeadline(t *testing.T) {
+	fr := &fakeRuntime{}
+	pr := &PodResolver{client: fr}
+	err := pr.Update(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := Listing{
+		Containers: map[string]string{"0123456789ab": "pod0"},
+		Pods:       map[string]string{"pod0": "virt-launcher"},
+	}
+	if !reflect.DeepEqual(pr.Listing(), expected) {
+		t.Errorf("mismatch: %#v", pr.Listing())
+	}
+
+	fr.wedged = true
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = pr.Update(ctx)
+	if err != context.DeadlineExceeded {
+		t.Errorf("unexpected error: %v", err)
+	}
+	// the previous listing is kept
+	if !reflect.DeepEqual(pr.Listing(), expected) {
+		t.Errorf("mismatch: %#v", pr.Listing())
+	}
+	if st := pr.Stats(); st.Calls != 3 || st.Errors != 1 {
+		t.Errorf("mismatch: %+v", st)
+	}
+}
@@ -0,0 +1,307 @@
+package procapi
+
+import (
+	"github.com/fromanirh/procwatch/procnotify"
+
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const unixPrefix = "unix:"
+
+// Server exposes the state of a Notifier over HTTP.
+type Server struct {
+	// Config is the configuration reported by /config, if not nil
+	Config interface{}
+	notif  *procnotify.Notifier
+	mux    *http.ServeMux
+}
+
+func NewServer(notif *procnotify.Notifier) *Server {
+	srv := &Server{
+		notif: notif,
+		mux:   http.NewServeMux(),
+	}
+	srv.mux.HandleFunc("/healthz", srv.healthz)
+	srv.mux.HandleFunc("/readyz", srv.readyz)
+	srv.mux.HandleFunc("/status", srv.status)
+	srv.mux.HandleFunc("/targets", srv.targets)
+	srv.mux.HandleFunc("/config", srv.config)
+	srv.mux.HandleFunc("/history", srv.history)
+	srv.mux.HandleFunc("/rescan", srv.rescan)
+	srv.mux.HandleFunc("/pods/refresh", srv.refreshPods)
+	return srv
+}
+
+func (srv *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	srv.mux.ServeHTTP(w, r)
+}
+
+// ListenAndServe serves on addr, either "host:port" or "unix:/path/to/sock".
+func (srv *Server) ListenAndServe(addr string) error {
+	ln, err := listen(addr)
+	if err != nil {
+		return err
+	}
+	return http.Serve(ln, srv)
+}
+
+func listen(addr string) (net.Listener, error) {
+	if strings.HasPrefix(addr, unixPrefix) {
+		path := strings.TrimPrefix(addr, unixPrefix)
+		// stale socket from a previous run
+		os.Remove(path)
+		return net.Listen("unix", path)
+	}
+	return net.Listen("tcp", addr)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	return true
+}
+
+func writeHealth(w http.ResponseWriter, ok bool, h procnotify.Health) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if ok {
+		fmt.Fprintf(w, "ok\n")
+		return
+	}
+	w.WriteHeader(http.StatusServiceUnavailable)
+	for _, reason := range h.Reasons {
+		fmt.Fprintf(w, "%s\n", reason)
+	}
+}
+
+func (srv *Server) healthz(w http.ResponseWriter, r *http.Request) {
+	h := srv.notif.Health(time.Now())
+	writeHealth(w, h.Live, h)
+}
+
+func (srv *Server) readyz(w http.ResponseWriter, r *http.Request) {
+	h := srv.notif.Health(time.Now())
+	writeHealth(w, h.Ready, h)
+}
+
+func (srv *Server) status(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	writeJSON(w, srv.notif.Status())
+}
+
+func (srv *Server) targets(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	writeJSON(w, srv.notif.Status().Targets)
+}
+
+func (srv *Server) config(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	if srv.Config == nil {
+		http.Error(w, "configuration not available", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, srv.Config)
+}
+
+func (srv *Server) rescan(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	err := srv.notif.Rescan()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, srv.notif.Status().Targets)
+}
+
+func (srv *Server) refreshPods(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	err := srv.notif.RefreshPods()
+	if err == procnotify.ErrNoPodResolver {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (srv *Server) history(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	if srv.notif.History == nil {
+		http.Error(w, "history disabled", http.StatusNotFound)
+		return
+	}
+	q, err := ParseQuery(r.URL.Query(), time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	items := srv.notif.History.Query(q)
+	if items == nil {
+		items = []procnotify.Sample{}
+	}
+	writeJSON(w, items)
+}
+
+// ParseQuery builds a history query from the parameters target, pid, metric,
+// since (a duration before now), from and to (RFC3339 times).
+func ParseQuery(values url.Values, now time.Time) (procnotify.Query, error) {
+	q := procnotify.Query{
+		Target: values.Get("target"),
+		Metric: values.Get("metric"),
+	}
+	if v := values.Get("pid"); v != "" {
+		pid, err := strconv.ParseInt(v, 10, 32)
+		if err != nil {
+			return q, fmt.Errorf("invalid pid %q: %v", v, err)
+		}
+		q.Pid = int32(pid)
+	}
+	if v := values.Get("since"); v != "" {
+		since, err := time.ParseDuration(v)
+		if err != nil {
+			return q, fmt.Errorf("invalid since %q: %v", v, err)
+		}
+		q.From = now.Add(-since)
+	}
+	if v := values.Get("from"); v != "" {
+		from, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return q, fmt.Errorf("invalid from %q: %v", v, err)
+		}
+		q.From = from
+	}
+	if v := values.Get("to"); v != "" {
+		to, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return q, fmt.Errorf("invalid to %q: %v", v, err)
+		}
+		q.To = to
+	}
+	return q, nil
+}
+
+// Values encodes a query in the form understood by ParseQuery.
+func Values(q procnotify.Query) url.Values {
+	values := url.Values{}
+	if q.Target != "" {
+		values.Set("target", q.Target)
+	}
+	if q.Pid != 0 {
+		values.Set("pid", strconv.Itoa(int(q.Pid)))
+	}
+	if q.Metric != "" {
+		values.Set("metric", q.Metric)
+	}
+	if !q.From.IsZero() {
+		values.Set("from", q.From.Format(time.RFC3339))
+	}
+	if !q.To.IsZero() {
+		values.Set("to", q.To.Format(time.RFC3339))
+	}
+	return values
+}
+
+// Client talks to a Server listening on addr, either "host:port" or "unix:/path/to/sock".
+type Client struct {
+	base string
+	http *http.Client
+}
+
+func NewClient(addr string, timeout time.Duration) *Client {
+	c := &Client{
+		base: "http://" + addr,
+		http: &http.Client{Timeout: timeout},
+	}
+	if strings.HasPrefix(addr, unixPrefix) {
+		path := strings.TrimPrefix(addr, unixPrefix)
+		c.base = "http://procwatch"
+		c.http.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", path)
+			},
+		}
+	}
+	return c
+}
+
+func (c *Client) do(method, path string, values url.Values, v interface{}) error {
+	u := c.base + path
+	if len(values) > 0 {
+		u += "?" + values.Encode()
+	}
+	req, err := http.NewRequest(method, u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		var msg [512]byte
+		n, _ := resp.Body.Read(msg[:])
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg[:n])))
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (c *Client) History(q procnotify.Query) ([]procnotify.Sample, error) {
+	var items []procnotify.Sample
+	err := c.do(http.MethodGet, "/history", Values(q), &items)
+	return items, err
+}
+
+func (c *Client) Status() (procnotify.Status, error) {
+	var st procnotify.Status
+	err := c.do(http.MethodGet, "/status", nil, &st)
+	return st, err
+}
+
+func (c *Client) Rescan() ([]procnotify.TargetStatus, error) {
+	var targets []procnotify.TargetStatus
+	err := c.do(http.MethodPost, "/rescan", nil, &targets)
+	return targets, err
+}
+
+func (c *Client) RefreshPods() error {
+	return c.do(http.MethodPost, "/pods/refresh", nil, nil)
+}
@@ -0,0 +1,94 @@
+package procapi
+
+import (
+	"github.com/fromanirh/procwatch/procfs/procfstest"
+	"github.com/fromanirh/procwatch/procnotify"
+
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseQuery(t *testing.T) {
+	now := time.Unix(1539000000, 0)
+	to := now.Add(-time.Minute).UTC()
+	q, err := ParseQuery(Values(procnotify.Query{Target: "vdsm", Pid: 42, Metric: "cpu", To: to}), now)
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if q.Target != "vdsm" || q.Pid != 42 || q.Metric != "cpu" || !q.To.Equal(to) || !q.From.IsZero() {
+		t.Errorf("mismatch: %+v", q)
+	}
+
+	q, err = ParseQuery(map[string][]string{"since": {"1h"}}, now)
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if !q.From.Equal(now.Add(-time.Hour)) {
+		t.Errorf("mismatch: %+v", q)
+	}
+
+	_, err = ParseQuery(map[string][]string{"pid": {"foo"}}, now)
+	if err == nil {
+		t.Errorf("expected error for invalid pid")
+	}
+}
+
+func TestHistoryEndpoint(t *testing.T) {
+	notif := procnotify.NewNotifier([]procnotify.Config{{Argv: []string{"vdsm"}}}, nil, "")
+	notif.History = procnotify.NewHistory(0)
+	notif.History.Add([]procnotify.Sample{
+		{Target: "vdsm", Pid: 42, Ident: "host/exec-vdsm-42", Name: "percent-cpu", Interval: 5, Time: time.Now(), Value: 3},
+		{Target: "vdsm", Pid: 43, Ident: "host/exec-vdsm-43", Name: "percent-cpu", Interval: 5, Time: time.Now(), Value: 4},
+	})
+	ts := httptest.NewServer(NewServer(notif))
+	defer ts.Close()
+
+	items, err := NewClient(strings.TrimPrefix(ts.URL, "http://"), time.Second).History(procnotify.Query{Pid: 43})
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if len(items) != 1 || items[0].Value != 4 {
+		t.Errorf("mismatch: %v", items)
+	}
+}
+
+func TestStatusEndpoint(t *testing.T) {
+	fs := procfstest.New(t)
+	defer fs.Remove()
+	defer fs.Use()()
+	fs.Add(procfstest.Proc{Pid: 1, Argv: []string{"/usr/lib/systemd/systemd"}})
+	fs.Add(procfstest.Proc{Pid: 2159, PPid: 1, Argv: []string{"/usr/bin/python2", "/usr/share/vdsm/vdsmd"}})
+
+	notif := procnotify.NewNotifier([]procnotify.Config{
+		{Name: "vdsm", Argv: []string{"/usr/bin/python2", "/usr/share/vdsm/vdsm*"}},
+		{Argv: []string{"procwatch-test-nonexistent"}},
+	}, nil, "/nonexistent.sock")
+	ts := httptest.NewServer(NewServer(notif))
+	defer ts.Close()
+	c := NewClient(strings.TrimPrefix(ts.URL, "http://"), time.Second)
+
+	targets, err := c.Rescan()
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if len(targets) != 2 || !reflect.DeepEqual(targets[0].Pids, []int32{2159}) ||
+		targets[1].Config.Name != "procwatch-test-nonexistent" || len(targets[1].Pids) != 0 {
+		t.Errorf("mismatch: %+v", targets)
+	}
+
+	st, err := c.Status()
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if st.LastScan.IsZero() || st.Sink.Path != "/nonexistent.sock" {
+		t.Errorf("mismatch: %+v", st)
+	}
+
+	err = c.RefreshPods()
+	if err == nil {
+		t.Errorf("expected error without pod resolution")
+	}
+}
@@ -1,18 +1,20 @@
 package procfind
 
 import (
+	"github.com/fromanirh/procwatch/procfs"
+	"github.com/fromanirh/procwatch/proclog"
+
 	"bytes"
-	"fmt"
 	"io/ioutil"
-	"os"
 	"path/filepath"
 	"strconv"
-	"strings"
+	"time"
 )
 
+var logger = proclog.New("procfind")
+
 func Match(cmdline []string, pid Pid) bool {
-	entry := fmt.Sprintf("/proc/%d/cmdline", int(pid))
-	argv := readProcCmdline(entry)
+	argv := readProcCmdline(procfs.PidPath(int32(pid), "cmdline"))
 
 	if argv == nil || len(argv) == 0 {
 		return false
@@ -35,7 +37,7 @@ func MatchAll(cmdline []string, pids []Pid) bool {
 }
 
 func Argv(pid Pid) []string {
-	return readProcCmdline(filepath.Join("/proc", strconv.Itoa(int(pid)), "cmdline"))
+	return readProcCmdline(procfs.PidPath(int32(pid), "cmdline"))
 }
 
 func Find(argv []string) (Pid, error) {
@@ -58,13 +60,34 @@ type EntryMatcher interface {
 	MatchArgv(argv []string) (Entry, bool)
 }
 
+// ScanStats describes a pass over /proc.
+type ScanStats struct {
+	// Entries is the number of /proc entries looked at
+	Entries int
+	// Matched is the number of entries matched
+	Matched  int
+	Duration time.Duration
+}
+
 func ScanEntries(em EntryMatcher) (int, error) {
-	procEntries, err := filepath.Glob("/proc/*/cmdline")
+	st, err := Scan(em)
+	return st.Matched, err
+}
+
+// Scan is like ScanEntries, but also reports how the scan went.
+func Scan(em EntryMatcher) (st ScanStats, err error) {
+	begin := time.Now()
+	defer func() {
+		st.Duration = time.Since(begin)
+		logger.Debug("scan done", "entries", st.Entries, "matched", st.Matched, "duration", st.Duration)
+	}()
+
+	procEntries, err := filepath.Glob(filepath.Join(procfs.Root, "*", "cmdline"))
 	if err != nil {
-		return 0, err
+		return st, err
 	}
 
-	var scanned int
+	st.Entries = len(procEntries)
 	for _, procEntry := range procEntries {
 		argv := readProcCmdline(procEntry)
 		if argv == nil || len(argv) == 0 {
@@ -76,18 +99,17 @@ func ScanEntries(em EntryMatcher) (int, error) {
 			continue
 		}
 
-		items := strings.Split(procEntry, string(os.PathSeparator))
-		// "", "proc", "$PID", "cmdline"
-		pid, err := strconv.Atoi(items[2])
+		// $ROOT/$PID/cmdline
+		pid, err := strconv.Atoi(filepath.Base(filepath.Dir(procEntry)))
 		if err != nil {
-			return 0, err
+			return st, err
 		}
 
 		entry.AddPid(Pid(pid))
-		scanned += 1
+		st.Matched += 1
 	}
 
-	return scanned, nil
+	return st, nil
 }
 
 func PidOf(exename string) ([]Pid, error) {
@@ -129,9 +151,8 @@ func findPidByArgv(cmdline []string, entries []string, firstOnly bool) ([]Pid, e
 			return pids, err
 		}
 		if matched {
-			items := strings.Split(entry, string(os.PathSeparator))
-			// "", "proc", "$PID", "cmdline"
-			pid, err := strconv.Atoi(items[2])
+			// $ROOT/$PID/cmdline
+			pid, err := strconv.Atoi(filepath.Base(filepath.Dir(entry)))
 			if err != nil {
 				return pids, err
 			}
@@ -150,7 +171,7 @@ func findPidByArgv(cmdline []string, entries []string, firstOnly bool) ([]Pid, e
 }
 
 func findInProcFs(argv []string, firstOnly bool) ([]Pid, error) {
-	entries, err := filepath.Glob("/proc/*/cmdline")
+	entries, err := filepath.Glob(filepath.Join(procfs.Root, "*", "cmdline"))
 	if err != nil {
 		return make([]Pid, 0), err
 	}
@@ -1,19 +1,148 @@
 package procfind
 
 import (
+	"github.com/fromanirh/procwatch/procfs/procfstest"
+
+	"path/filepath"
+	"reflect"
+	"sort"
 	"testing"
 )
 
+func newFakeProcFS(t *testing.T) *procfstest.FS {
+	fs := procfstest.New(t)
+	fs.Add(procfstest.Proc{Pid: 1, Argv: []string{"/usr/lib/systemd/systemd", "--system"}})
+	fs.Add(procfstest.Proc{Pid: 2159, PPid: 1, Argv: []string{"/usr/bin/python2", "/usr/share/vdsm/vdsmd"}})
+	fs.Add(procfstest.Proc{Pid: 2192, PPid: 1, Argv: []string{"/usr/libexec/qemu-kvm", "-name", "vm1"}})
+	fs.Add(procfstest.Proc{Pid: 2475, PPid: 1, Argv: []string{"/usr/libexec/qemu-kvm", "-name", "vm2"}})
+	// kernel threads have no command line
+	fs.Add(procfstest.Proc{Pid: 2477, PPid: 2, Comm: "kworker/0:1"})
+	return fs
+}
+
 func TestReadProcCmdline(t *testing.T) {
-	argv := readProcCmdline("/proc/1/cmdline")
-	if len(argv) == 0 {
-		t.Errorf("failed to read cmdline of pid 1")
+	fs := newFakeProcFS(t)
+	defer fs.Remove()
+
+	argv := readProcCmdline(filepath.Join(fs.Root, "2159", "cmdline"))
+	expected := []string{"/usr/bin/python2", "/usr/share/vdsm/vdsmd"}
+	if !reflect.DeepEqual(argv, expected) {
+		t.Errorf("mismatch: got %#v expected %#v", argv, expected)
 	}
 }
 
 func TestReadProcCmdlineInexistent(t *testing.T) {
-	argv := readProcCmdline("/proc/0/cmdline")
+	fs := newFakeProcFS(t)
+	defer fs.Remove()
+
+	argv := readProcCmdline(filepath.Join(fs.Root, "0", "cmdline"))
 	if len(argv) > 0 {
 		t.Errorf("Unexpected data for pid 0: %#v", argv)
 	}
 }
+
+type fakeEntry struct {
+	argv []string
+	pids []Pid
+}
+
+func (fe *fakeEntry) AddPid(p Pid) {
+	fe.pids = append(fe.pids, p)
+}
+
+type fakeMatcher struct {
+	entries []*fakeEntry
+}
+
+func (fm *fakeMatcher) MatchArgv(argv []string) (Entry, bool) {
+	for _, fe := range fm.entries {
+		if match, err := MatchArgv(argv, fe.argv); err == nil && match {
+			return fe, true
+		}
+	}
+	return nil, false
+}
+
+func TestScanEntries(t *testing.T) {
+	fs := newFakeProcFS(t)
+	defer fs.Remove()
+	defer fs.Use()()
+
+	qemu := &fakeEntry{argv: []string{"/usr/libexec/qemu-kvm"}}
+	vdsm := &fakeEntry{argv: []string{"/usr/bin/python2", "/usr/share/vdsm/vdsm*"}}
+	none := &fakeEntry{argv: []string{"/usr/sbin/libvirtd"}}
+	fm := &fakeMatcher{entries: []*fakeEntry{qemu, vdsm, none}}
+
+	matched, err := ScanEntries(fm)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if matched != 3 {
+		t.Errorf("mismatch: matched %d expected 3", matched)
+	}
+	sort.Slice(qemu.pids, func(i, j int) bool { return qemu.pids[i] < qemu.pids[j] })
+	if !reflect.DeepEqual(qemu.pids, []Pid{2192, 2475}) {
+		t.Errorf("mismatch: got %v", qemu.pids)
+	}
+	if !reflect.DeepEqual(vdsm.pids, []Pid{2159}) {
+		t.Errorf("mismatch: got %v", vdsm.pids)
+	}
+	if len(none.pids) != 0 {
+		t.Errorf("unexpected match: %v", none.pids)
+	}
+}
+
+func TestScanStats(t *testing.T) {
+	fs := newFakeProcFS(t)
+	defer fs.Remove()
+	defer fs.Use()()
+
+	st, err := Scan(&fakeMatcher{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if st.Entries != 5 || st.Matched != 0 {
+		t.Errorf("mismatch: %#v", st)
+	}
+}
+
+func TestMatchPid(t *testing.T) {
+	fs := newFakeProcFS(t)
+	defer fs.Remove()
+	defer fs.Use()()
+
+	if !Match([]string{"/usr/libexec/qemu-kvm", "-name", "vm1"}, 2192) {
+		t.Errorf("expected match for pid 2192")
+	}
+	if Match([]string{"/usr/libexec/qemu-kvm", "-name", "vm1"}, 2475) {
+		t.Errorf("unexpected match for pid 2475")
+	}
+	if Match([]string{"/usr/libexec/qemu-kvm"}, 2477) {
+		t.Errorf("unexpected match for a kernel thread")
+	}
+
+	fs.Kill(2192)
+	if Match([]string{"/usr/libexec/qemu-kvm"}, 2192) {
+		t.Errorf("unexpected match for a gone process")
+	}
+}
+
+func TestFindAll(t *testing.T) {
+	fs := newFakeProcFS(t)
+	defer fs.Remove()
+	defer fs.Use()()
+
+	pids, err := FindAll([]string{"/usr/libexec/qemu-kvm"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	sort.Slice(pids, func(i, j int) bool { return pids[i] < pids[j] })
+	if !reflect.DeepEqual(pids, []Pid{2192, 2475}) {
+		t.Errorf("mismatch: got %v", pids)
+	}
+
+	_, err = FindAll([]string{"/usr/sbin/libvirtd"})
+	if err != ErrPidNotFound {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
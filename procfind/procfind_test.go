@@ -1,10 +1,44 @@
 package procfind
 
 import (
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 )
 
+// newFakeBin creates a bin and a usr/bin directory with an executable
+// sh in bin, and a plain file, and returns the root of the tree.
+func newFakeBin(t *testing.T) string {
+	root, err := ioutil.TempDir("", "procfind")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	files := []struct {
+		name string
+		mode os.FileMode
+	}{
+		{"bin/sh", 0755},
+		{"usr/bin/true", 0755},
+		{"cmdline", 0644},
+	}
+	for _, file := range files {
+		path := filepath.Join(root, file.name)
+		err = os.MkdirAll(filepath.Dir(path), 0755)
+		if err == nil {
+			err = ioutil.WriteFile(path, []byte("#!/bin/true\n"), file.mode)
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	return root
+}
+
+func fakePath(root string) string {
+	return filepath.Join(root, "bin") + ":" + filepath.Join(root, "usr", "bin")
+}
+
 func TestPathNoEnv(t *testing.T) {
 	oldPath := os.Getenv("PATH")
 	os.Unsetenv("PATH")
@@ -28,19 +62,29 @@ func TestPathWithEnv(t *testing.T) {
 }
 
 func TestFindExeSh(t *testing.T) {
-	testPath := "/bin:/usr/bin"
-	val, err := FindExe("sh", testPath)
-	expect(t, err, val, "/bin/sh")
+	root := newFakeBin(t)
+	defer os.RemoveAll(root)
+
+	val, err := FindExe("sh", fakePath(root))
+	expect(t, err, val, filepath.Join(root, "bin", "sh"))
+	val, err = FindExe("true", fakePath(root))
+	expect(t, err, val, filepath.Join(root, "usr", "bin", "true"))
 }
 
 func TestFindExeShAbsolute(t *testing.T) {
-	val, err := FindExe("/bin/sh", "")
-	expect(t, err, val, "/bin/sh")
+	root := newFakeBin(t)
+	defer os.RemoveAll(root)
+
+	sh := filepath.Join(root, "bin", "sh")
+	val, err := FindExe(sh, "")
+	expect(t, err, val, sh)
 }
 
 func TestFindExeInexistent(t *testing.T) {
-	testPath := "/bin:/usr/bin"
-	_, err := FindExe("inexistent", testPath)
+	root := newFakeBin(t)
+	defer os.RemoveAll(root)
+
+	_, err := FindExe("inexistent", fakePath(root))
 	if err != ErrExeNotFound {
 		t.Errorf("unexpected error: %s", err)
 	}
@@ -54,7 +98,10 @@ func TestFindShNoPath(t *testing.T) {
 }
 
 func TestFindSomethingNotExec(t *testing.T) {
-	_, err := FindExe("/proc/cmdline", "")
+	root := newFakeBin(t)
+	defer os.RemoveAll(root)
+
+	_, err := FindExe(filepath.Join(root, "cmdline"), "")
 	if err != ErrExeNotFound {
 		t.Errorf("unexpected error: %s", err)
 	}
@@ -72,14 +119,14 @@ func TestWhichNoEnv(t *testing.T) {
 }
 
 func TestWhichWithEnv(t *testing.T) {
-	testPath := "/bin:/sbin:/usr/bin:/usr/sbin"
+	root := newFakeBin(t)
+	defer os.RemoveAll(root)
 	oldPath := os.Getenv("PATH")
-	os.Unsetenv("PATH")
-	os.Setenv("PATH", testPath)
+	os.Setenv("PATH", fakePath(root))
 	defer os.Setenv("PATH", oldPath)
 
 	val, err := Which("sh")
-	expect(t, err, val, "/bin/sh")
+	expect(t, err, val, filepath.Join(root, "bin", "sh"))
 }
 
 func TestMatchArgv(t *testing.T) {
@@ -0,0 +1,61 @@
+package procfs
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// BootTime returns the time the system booted, in seconds since the epoch.
+func BootTime() (int64, error) {
+	file, err := os.Open(filepath.Join(Root, "stat"))
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "btime ") {
+			continue
+		}
+		btime, err := strconv.ParseInt(strings.TrimSpace(line[len("btime "):]), 10, 64)
+		if err != nil {
+			return 0, ErrMalformedEntry
+		}
+		return btime, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, ErrMalformedEntry
+}
+
+// NumCPU returns the number of CPUs listed in the system statistics.
+func NumCPU() (int, error) {
+	file, err := os.Open(filepath.Join(Root, "stat"))
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	ncpu := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		// skip the "cpu " aggregate line
+		if strings.HasPrefix(line, "cpu") && !strings.HasPrefix(line, "cpu ") {
+			ncpu++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	if ncpu == 0 {
+		return 0, ErrMalformedEntry
+	}
+	return ncpu, nil
+}
@@ -0,0 +1,43 @@
+package procfs
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// UserHZ is the frequency of the clock ticks the kernel uses to report
+// times to userspace. It is fixed to 100 on all the architectures we run on.
+const UserHZ = 100
+
+var (
+	ErrMalformedEntry = errors.New("malformed proc entry")
+)
+
+// Root is where the proc filesystem is mounted.
+var Root = "/proc"
+
+// SetRoot makes procfs, and gopsutil, read the proc filesystem at root.
+// The returned function restores the previous setting.
+func SetRoot(root string) func() {
+	prevRoot := Root
+	hostProc, hasHostProc := os.LookupEnv("HOST_PROC")
+
+	Root = root
+	os.Setenv("HOST_PROC", root)
+
+	return func() {
+		Root = prevRoot
+		if hasHostProc {
+			os.Setenv("HOST_PROC", hostProc)
+		} else {
+			os.Unsetenv("HOST_PROC")
+		}
+	}
+}
+
+func PidPath(pid int32, name ...string) string {
+	elems := append([]string{Root, strconv.Itoa(int(pid))}, name...)
+	return filepath.Join(elems...)
+}
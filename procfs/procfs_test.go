@@ -0,0 +1,114 @@
+package procfs_test
+
+import (
+	"github.com/fromanirh/procwatch/procfs"
+	"github.com/fromanirh/procwatch/procfs/procfstest"
+
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// the fake filesystem imports procfs, so these tests live outside of it
+
+func newFakeProcFS(t *testing.T) *procfstest.FS {
+	fs := procfstest.New(t)
+	fs.Add(procfstest.Proc{Pid: 1, Argv: []string{"/usr/lib/systemd/systemd", "--system"}})
+	fs.Add(procfstest.Proc{Pid: 2159, PPid: 1, Argv: []string{"/usr/bin/python2", "/usr/share/vdsm/vdsmd"}, Threads: 3, FDs: 32})
+	fs.Add(procfstest.Proc{Pid: 2300, PPid: 2159, Argv: []string{"/usr/bin/dd"}})
+	fs.Add(procfstest.Proc{Pid: 2192, PPid: 1, Argv: []string{"/usr/libexec/qemu-kvm"}})
+	return fs
+}
+
+func TestReadStat(t *testing.T) {
+	fs := newFakeProcFS(t)
+	defer fs.Remove()
+	defer fs.Use()()
+
+	st, err := procfs.ReadStat(2159)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if st.Pid != 2159 || st.Ppid != 1 || st.Comm != "python2" || st.NumThreads != 3 {
+		t.Errorf("mismatch: %#v", st)
+	}
+
+	_, err = procfs.ReadStat(4242)
+	if err == nil {
+		t.Errorf("expected error for a missing process")
+	}
+}
+
+func TestBootTime(t *testing.T) {
+	fs := newFakeProcFS(t)
+	defer fs.Remove()
+	defer fs.Use()()
+
+	btime, err := procfs.BootTime()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if btime != procfstest.BootTime {
+		t.Errorf("mismatch: boot time %v expected %v", btime, procfstest.BootTime)
+	}
+}
+
+func TestNumCPU(t *testing.T) {
+	fs := newFakeProcFS(t)
+	defer fs.Remove()
+	defer fs.Use()()
+
+	ncpu, err := procfs.NumCPU()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if ncpu != procfstest.NumCPU {
+		t.Errorf("mismatch: %v CPUs expected %v", ncpu, procfstest.NumCPU)
+	}
+}
+
+func TestCountFDs(t *testing.T) {
+	fs := newFakeProcFS(t)
+	defer fs.Remove()
+	defer fs.Use()()
+
+	fds, err := procfs.CountFDs(2159)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if fds != 32 {
+		t.Errorf("mismatch: %d fds expected 32", fds)
+	}
+}
+
+func TestTasks(t *testing.T) {
+	fs := newFakeProcFS(t)
+	defer fs.Remove()
+	defer fs.Use()()
+
+	tids, err := procfs.Tasks(2159)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	sort.Slice(tids, func(i, j int) bool { return tids[i] < tids[j] })
+	if !reflect.DeepEqual(tids, []int32{2159, 2160, 2161}) {
+		t.Errorf("mismatch: %v", tids)
+	}
+}
+
+func TestReadTree(t *testing.T) {
+	fs := newFakeProcFS(t)
+	defer fs.Remove()
+	defer fs.Use()()
+
+	tree, err := procfs.ReadTree()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got := tree.Children(1); !reflect.DeepEqual(got, []int32{2159, 2192}) {
+		t.Errorf("mismatch: children %v", got)
+	}
+	if got := tree.Descendants(2159); !reflect.DeepEqual(got, []int32{2300}) {
+		t.Errorf("mismatch: descendants %v", got)
+	}
+}
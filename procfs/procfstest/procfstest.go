@@ -0,0 +1,205 @@
+// Package procfstest builds fake proc filesystems, so the tests don't
+// depend on the processes running on the host.
+package procfstest
+
+import (
+	"github.com/fromanirh/procwatch/procfs"
+
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const (
+	// BootTime is the boot time of the fake system, in seconds since the epoch
+	BootTime = 1542700000
+	// NumCPU is the number of CPUs of the fake system
+	NumCPU = 4
+	// MaxFDs is the limit of the open files of the fake processes
+	MaxFDs = 1024
+)
+
+// Proc describes a fake process. Times are in clock ticks,
+// memory sizes in bytes.
+type Proc struct {
+	Pid  int32
+	PPid int32
+	Argv []string
+	// Comm defaults to the base name of Argv[0]
+	Comm      string
+	UTime     uint64
+	STime     uint64
+	StartTime uint64
+	VSize     uint64
+	RSS       uint64
+	MinFlt    uint64
+	MajFlt    uint64
+	Threads   int
+	FDs       int
+	// CtxtSwitches is the number of voluntary context switches
+	CtxtSwitches uint64
+	ReadBytes    uint64
+	WriteBytes   uint64
+	ReadOps      uint64
+	WriteOps     uint64
+	// CGroup is the content of the cgroup file
+	CGroup string
+	// Tasks are the threads besides the main one. If empty, the process
+	// has Threads threads named after it, and the main one does all the work.
+	Tasks []Task
+}
+
+// Task describes a thread of a fake process.
+type Task struct {
+	Tid       int32
+	Comm      string
+	UTime     uint64
+	STime     uint64
+	Processor int
+}
+
+// FS is a fake proc filesystem in a temporary directory.
+type FS struct {
+	Root string
+	t    testing.TB
+}
+
+// New creates an empty fake proc filesystem. Call Remove when done.
+func New(t testing.TB) *FS {
+	root, err := ioutil.TempDir("", "procfstest")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	fs := &FS{Root: root, t: t}
+	var stat strings.Builder
+	fmt.Fprintf(&stat, "cpu  100 0 100 1000 0 0 0 0 0 0\n")
+	for cpu := 0; cpu < NumCPU; cpu++ {
+		fmt.Fprintf(&stat, "cpu%d 25 0 25 250 0 0 0 0 0 0\n", cpu)
+	}
+	fmt.Fprintf(&stat, "btime %d\n", BootTime)
+	fs.write(stat.String(), "stat")
+	return fs
+}
+
+// Use makes procfs and gopsutil read the fake filesystem. The returned
+// function restores the previous setting.
+func (fs *FS) Use() func() {
+	return procfs.SetRoot(fs.Root)
+}
+
+func (fs *FS) Remove() {
+	os.RemoveAll(fs.Root)
+}
+
+func (fs *FS) write(content string, name ...string) {
+	path := filepath.Join(append([]string{fs.Root}, name...)...)
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err == nil {
+		err = ioutil.WriteFile(path, []byte(content), 0644)
+	}
+	if err != nil {
+		fs.t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+// Add adds the process, or replaces it if a process with
+// the same pid exists.
+func (fs *FS) Add(p Proc) {
+	fs.Kill(p.Pid)
+	pid := strconv.Itoa(int(p.Pid))
+	comm := p.Comm
+	if comm == "" && len(p.Argv) > 0 {
+		comm = filepath.Base(p.Argv[0])
+	}
+	threads := p.Threads
+	if len(p.Tasks) > 0 {
+		threads = 1 + len(p.Tasks)
+	}
+	if threads < 1 {
+		threads = 1
+	}
+	pageSize := uint64(os.Getpagesize())
+
+	cmdline := ""
+	if len(p.Argv) > 0 {
+		// kernel threads have an empty command line
+		cmdline = strings.Join(p.Argv, "\x00") + "\x00"
+	}
+	fs.write(cmdline, pid, "cmdline")
+	fs.write(comm+"\n", pid, "comm")
+	fs.write(formatStat(p.Pid, comm, p, threads, 0), pid, "stat")
+	fs.write(fmt.Sprintf("%d %d 0 0 0 0 0\n", p.VSize/pageSize, p.RSS/pageSize), pid, "statm")
+	fs.write(fmt.Sprintf("Name:\t%s\nState:\tS (sleeping)\nPid:\t%d\nPPid:\t%d\nThreads:\t%d\n"+
+		"voluntary_ctxt_switches:\t%d\nnonvoluntary_ctxt_switches:\t0\n",
+		comm, p.Pid, p.PPid, threads, p.CtxtSwitches), pid, "status")
+	fs.write(fmt.Sprintf("rchar: %d\nwchar: %d\nsyscr: %d\nsyscw: %d\nread_bytes: %d\nwrite_bytes: %d\ncancelled_write_bytes: 0\n",
+		p.ReadBytes, p.WriteBytes, p.ReadOps, p.WriteOps, p.ReadBytes, p.WriteBytes), pid, "io")
+	fs.write(fmt.Sprintf("%-26s%-21s%-21s%-10s\n%-26s%-21d%-21d%-10s\n",
+		"Limit", "Soft Limit", "Hard Limit", "Units",
+		"Max open files", MaxFDs, MaxFDs, "files"), pid, "limits")
+	fs.write(fmt.Sprintf("%d %d %d\n", (p.UTime+p.STime)*10000000, 0, p.UTime+p.STime), pid, "schedstat")
+	fs.write(p.CGroup, pid, "cgroup")
+
+	err := os.MkdirAll(filepath.Join(fs.Root, pid, "fd"), 0755)
+	if err != nil {
+		fs.t.Fatalf("unexpected error: %s", err)
+	}
+	for fd := 0; fd < p.FDs; fd++ {
+		fs.write("", pid, "fd", strconv.Itoa(fd))
+	}
+	tasks := []Task{{Tid: p.Pid, Comm: comm, UTime: p.UTime, STime: p.STime}}
+	if len(p.Tasks) > 0 {
+		tasks = append(tasks, p.Tasks...)
+	} else {
+		// the main thread does all the work
+		for i := 1; i < threads; i++ {
+			tasks = append(tasks, Task{Tid: p.Pid + int32(i), Comm: comm})
+		}
+	}
+	for _, task := range tasks {
+		tid := strconv.Itoa(int(task.Tid))
+		tp := Proc{PPid: p.PPid, UTime: task.UTime, STime: task.STime, StartTime: p.StartTime}
+		if task.Tid == p.Pid {
+			tp = p
+		}
+		fs.write(task.Comm+"\n", pid, "task", tid, "comm")
+		fs.write(formatStat(task.Tid, task.Comm, tp, threads, task.Processor), pid, "task", tid, "stat")
+		fs.write(fmt.Sprintf("%d 0 %d\n", (task.UTime+task.STime)*10000000, task.UTime+task.STime), pid, "task", tid, "schedstat")
+	}
+}
+
+// Kill removes the process, if it exists.
+func (fs *FS) Kill(pid int32) {
+	err := os.RemoveAll(filepath.Join(fs.Root, strconv.Itoa(int(pid))))
+	if err != nil {
+		fs.t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+// formatStat renders a stat file, as described in proc(5).
+func formatStat(pid int32, comm string, p Proc, threads, processor int) string {
+	// fields[0] is the field #3 in proc(5)
+	fields := make([]string, 50)
+	for i := range fields {
+		fields[i] = "0"
+	}
+	set := func(num int, val interface{}) {
+		fields[num-3] = fmt.Sprint(val)
+	}
+	set(3, "S")
+	set(4, p.PPid)
+	set(10, p.MinFlt)
+	set(12, p.MajFlt)
+	set(14, p.UTime)
+	set(15, p.STime)
+	set(20, threads)
+	set(22, p.StartTime)
+	set(23, p.VSize)
+	set(24, p.RSS/uint64(os.Getpagesize()))
+	set(39, processor)
+	return fmt.Sprintf("%d (%s) %s\n", pid, comm, strings.Join(fields, " "))
+}
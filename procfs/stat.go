@@ -0,0 +1,116 @@
+package procfs
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// Stat holds the fields of /proc/<pid>/stat we care about.
+// Times are expressed in clock ticks (see UserHZ).
+type Stat struct {
+	Pid        int32
+	Comm       string
+	State      string
+	Ppid       int32
+	MinFlt     uint64
+	MajFlt     uint64
+	UTime      uint64
+	STime      uint64
+	NumThreads int64
+	StartTime  uint64
+	VSize      uint64
+	RSS        int64
+	Processor  int64
+	BlkioTicks uint64
+	GuestTime  uint64
+	CGuestTime uint64
+	// Fields is the number of fields in the file: older kernels
+	// don't report the last ones, which are then zero
+	Fields int
+}
+
+func ReadStat(pid int32) (Stat, error) {
+	content, err := ioutil.ReadFile(PidPath(pid, "stat"))
+	if err != nil {
+		return Stat{}, err
+	}
+	return ParseStat(content)
+}
+
+// ParseStat parses the content of a stat file, as described in proc(5).
+func ParseStat(content []byte) (Stat, error) {
+	var st Stat
+	// comm may contain spaces and parens, so we look for the last paren.
+	begin := bytes.IndexByte(content, '(')
+	end := bytes.LastIndexByte(content, ')')
+	if begin < 0 || end < begin {
+		return st, ErrMalformedEntry
+	}
+	pid, err := strconv.ParseInt(strings.TrimSpace(string(content[:begin])), 10, 32)
+	if err != nil {
+		return st, ErrMalformedEntry
+	}
+	st.Pid = int32(pid)
+	st.Comm = string(content[begin+1 : end])
+
+	// fields[0] is the field #3 in proc(5)
+	fields := strings.Fields(string(content[end+1:]))
+	if len(fields) < 22 {
+		return st, ErrMalformedEntry
+	}
+	st.Fields = len(fields) + 2
+	field := func(num int) string {
+		idx := num - 3
+		if idx >= len(fields) {
+			return "0"
+		}
+		return fields[idx]
+	}
+
+	st.State = field(3)
+	ppid, err := strconv.ParseInt(field(4), 10, 32)
+	if err != nil {
+		return st, ErrMalformedEntry
+	}
+	st.Ppid = int32(ppid)
+
+	uints := []struct {
+		num int
+		val *uint64
+	}{
+		{10, &st.MinFlt},
+		{12, &st.MajFlt},
+		{14, &st.UTime},
+		{15, &st.STime},
+		{22, &st.StartTime},
+		{23, &st.VSize},
+		{42, &st.BlkioTicks},
+		{43, &st.GuestTime},
+		{44, &st.CGuestTime},
+	}
+	for _, u := range uints {
+		*u.val, err = strconv.ParseUint(field(u.num), 10, 64)
+		if err != nil {
+			return st, ErrMalformedEntry
+		}
+	}
+
+	ints := []struct {
+		num int
+		val *int64
+	}{
+		{20, &st.NumThreads},
+		{24, &st.RSS},
+		{39, &st.Processor},
+	}
+	for _, i := range ints {
+		*i.val, err = strconv.ParseInt(field(i.num), 10, 64)
+		if err != nil {
+			return st, ErrMalformedEntry
+		}
+	}
+
+	return st, nil
+}
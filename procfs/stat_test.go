@@ -0,0 +1,59 @@
+package procfs
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+func TestParseStat(t *testing.T) {
+	content, err := ioutil.ReadFile("testdata/stat")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	st, err := ParseStat(content)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := Stat{
+		Pid:        2192,
+		Comm:       "qemu-kvm (vm 1)",
+		State:      "S",
+		Ppid:       2175,
+		MinFlt:     154877,
+		MajFlt:     12,
+		UTime:      38152,
+		STime:      9741,
+		NumThreads: 7,
+		StartTime:  3941,
+		VSize:      3097939968,
+		RSS:        241020,
+		Processor:  3,
+		BlkioTicks: 87,
+		GuestTime:  21013,
+		Fields:     52,
+	}
+	if st != expected {
+		t.Errorf("mismatch:\ngot      %#v\nexpected %#v", st, expected)
+	}
+}
+
+func TestParseStatOldKernel(t *testing.T) {
+	// no delayacct_blkio_ticks, guest_time and later
+	content := "42 (sh) S 1 42 42 0 -1 4202816 10 0 0 0 5 3 0 0 20 0 1 0 3941 1000 10 100 1 1 0 0 0 0 0 0 0 0 0 0 17 3 0 0\n"
+	st, err := ParseStat([]byte(content))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if st.Fields != 41 || st.UTime != 5 || st.BlkioTicks != 0 || st.GuestTime != 0 {
+		t.Errorf("mismatch: %#v", st)
+	}
+}
+
+func TestParseStatMalformed(t *testing.T) {
+	for _, content := range []string{"", "42 (sh", "42 (sh) S"} {
+		_, err := ParseStat([]byte(content))
+		if err != ErrMalformedEntry {
+			t.Errorf("unexpected error for %q: %v", content, err)
+		}
+	}
+}
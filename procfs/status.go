@@ -0,0 +1,131 @@
+package procfs
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Status holds the fields of /proc/<pid>/status we care about.
+type Status struct {
+	Threads                  int64
+	VoluntaryCtxtSwitches    uint64
+	NonvoluntaryCtxtSwitches uint64
+}
+
+func ReadStatus(pid int32) (Status, error) {
+	content, err := ioutil.ReadFile(PidPath(pid, "status"))
+	if err != nil {
+		return Status{}, err
+	}
+	return ParseStatus(content)
+}
+
+func ParseStatus(content []byte) (Status, error) {
+	var st Status
+	var err error
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		items := strings.SplitN(scanner.Text(), ":", 2)
+		if len(items) != 2 {
+			continue
+		}
+		value := strings.TrimSpace(items[1])
+		switch items[0] {
+		case "Threads":
+			st.Threads, err = strconv.ParseInt(value, 10, 64)
+		case "voluntary_ctxt_switches":
+			st.VoluntaryCtxtSwitches, err = strconv.ParseUint(value, 10, 64)
+		case "nonvoluntary_ctxt_switches":
+			st.NonvoluntaryCtxtSwitches, err = strconv.ParseUint(value, 10, 64)
+		}
+		if err != nil {
+			return st, ErrMalformedEntry
+		}
+	}
+	return st, scanner.Err()
+}
+
+// Unlimited is the value reported for limits which are not set.
+const Unlimited = ^uint64(0)
+
+type Limit struct {
+	Soft uint64
+	Hard uint64
+}
+
+const (
+	LimitOpenFiles = "Max open files"
+	LimitProcesses = "Max processes"
+)
+
+// ReadLimits returns the resource limits of the process, keyed by
+// their name, as in /proc/<pid>/limits (e.g. LimitOpenFiles).
+func ReadLimits(pid int32) (map[string]Limit, error) {
+	content, err := ioutil.ReadFile(PidPath(pid, "limits"))
+	if err != nil {
+		return nil, err
+	}
+	return ParseLimits(content)
+}
+
+func ParseLimits(content []byte) (map[string]Limit, error) {
+	limits := make(map[string]Limit)
+	lines := strings.Split(string(content), "\n")
+	if len(lines) == 0 || !strings.HasPrefix(lines[0], "Limit") {
+		return nil, ErrMalformedEntry
+	}
+	// the header tells us where the columns begin, and names may contain spaces
+	softCol := strings.Index(lines[0], "Soft Limit")
+	if softCol < 0 {
+		return nil, ErrMalformedEntry
+	}
+	for _, line := range lines[1:] {
+		if len(line) <= softCol {
+			continue
+		}
+		name := strings.TrimSpace(line[:softCol])
+		fields := strings.Fields(line[softCol:])
+		if len(fields) < 2 {
+			return nil, ErrMalformedEntry
+		}
+		soft, err := parseLimit(fields[0])
+		if err != nil {
+			return nil, err
+		}
+		hard, err := parseLimit(fields[1])
+		if err != nil {
+			return nil, err
+		}
+		limits[name] = Limit{Soft: soft, Hard: hard}
+	}
+	return limits, nil
+}
+
+func parseLimit(value string) (uint64, error) {
+	if value == "unlimited" {
+		return Unlimited, nil
+	}
+	val, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, ErrMalformedEntry
+	}
+	return val, nil
+}
+
+// CountFDs returns the number of file descriptors the process has open.
+func CountFDs(pid int32) (int, error) {
+	dir, err := os.Open(PidPath(pid, "fd"))
+	if err != nil {
+		return 0, err
+	}
+	defer dir.Close()
+	names, err := dir.Readdirnames(-1)
+	if err != nil {
+		return 0, err
+	}
+	return len(names), nil
+}
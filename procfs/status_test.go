@@ -0,0 +1,42 @@
+package procfs
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+func TestParseStatus(t *testing.T) {
+	content, err := ioutil.ReadFile("testdata/status")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	st, err := ParseStatus(content)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := Status{
+		Threads:                  17,
+		VoluntaryCtxtSwitches:    43188,
+		NonvoluntaryCtxtSwitches: 1274,
+	}
+	if st != expected {
+		t.Errorf("mismatch:\ngot      %#v\nexpected %#v", st, expected)
+	}
+}
+
+func TestParseLimits(t *testing.T) {
+	content, err := ioutil.ReadFile("testdata/limits")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	limits, err := ParseLimits(content)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if lim := limits[LimitOpenFiles]; lim.Soft != 20000 || lim.Hard != 20000 {
+		t.Errorf("unexpected open files limit: %#v", lim)
+	}
+	if lim := limits["Max cpu time"]; lim.Soft != Unlimited {
+		t.Errorf("unexpected cpu time limit: %#v", lim)
+	}
+}
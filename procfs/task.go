@@ -0,0 +1,79 @@
+package procfs
+
+import (
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Tasks returns the IDs of the threads of the process.
+func Tasks(pid int32) ([]int32, error) {
+	dir, err := os.Open(PidPath(pid, "task"))
+	if err != nil {
+		return nil, err
+	}
+	defer dir.Close()
+	names, err := dir.Readdirnames(-1)
+	if err != nil {
+		return nil, err
+	}
+	tids := make([]int32, 0, len(names))
+	for _, name := range names {
+		tid, err := strconv.Atoi(name)
+		if err != nil {
+			continue
+		}
+		tids = append(tids, int32(tid))
+	}
+	return tids, nil
+}
+
+func ReadTaskStat(pid, tid int32) (Stat, error) {
+	content, err := ioutil.ReadFile(PidPath(pid, "task", strconv.Itoa(int(tid)), "stat"))
+	if err != nil {
+		return Stat{}, err
+	}
+	return ParseStat(content)
+}
+
+// Schedstat holds the content of /proc/<pid>/schedstat.
+// Times are expressed in nanoseconds.
+type Schedstat struct {
+	RunTime    uint64
+	WaitTime   uint64
+	Timeslices uint64
+}
+
+func ReadSchedstat(pid int32) (Schedstat, error) {
+	content, err := ioutil.ReadFile(PidPath(pid, "schedstat"))
+	if err != nil {
+		return Schedstat{}, err
+	}
+	return ParseSchedstat(content)
+}
+
+func ReadTaskSchedstat(pid, tid int32) (Schedstat, error) {
+	content, err := ioutil.ReadFile(PidPath(pid, "task", strconv.Itoa(int(tid)), "schedstat"))
+	if err != nil {
+		return Schedstat{}, err
+	}
+	return ParseSchedstat(content)
+}
+
+func ParseSchedstat(content []byte) (Schedstat, error) {
+	var ss Schedstat
+	fields := strings.Fields(string(content))
+	if len(fields) != 3 {
+		return ss, ErrMalformedEntry
+	}
+	vals := []*uint64{&ss.RunTime, &ss.WaitTime, &ss.Timeslices}
+	for idx, val := range vals {
+		var err error
+		*val, err = strconv.ParseUint(fields[idx], 10, 64)
+		if err != nil {
+			return ss, ErrMalformedEntry
+		}
+	}
+	return ss, nil
+}
@@ -0,0 +1,21 @@
+package procfs
+
+import (
+	"testing"
+)
+
+func TestParseSchedstat(t *testing.T) {
+	ss, err := ParseSchedstat([]byte("1348592045 274915 2013\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := Schedstat{RunTime: 1348592045, WaitTime: 274915, Timeslices: 2013}
+	if ss != expected {
+		t.Errorf("mismatch: got %#v expected %#v", ss, expected)
+	}
+
+	_, err = ParseSchedstat([]byte("1348592045 274915"))
+	if err != ErrMalformedEntry {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
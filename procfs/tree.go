@@ -0,0 +1,49 @@
+package procfs
+
+import (
+	"path/filepath"
+	"strconv"
+)
+
+// Tree maps each process to its children.
+type Tree map[int32][]int32
+
+// ReadTree builds the process tree from the parent PIDs of all the
+// processes currently running.
+func ReadTree() (Tree, error) {
+	entries, err := filepath.Glob(filepath.Join(Root, "[0-9]*", "stat"))
+	if err != nil {
+		return nil, err
+	}
+	tree := make(Tree)
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(filepath.Base(filepath.Dir(entry)))
+		if err != nil {
+			continue
+		}
+		st, err := ReadStat(int32(pid))
+		if err != nil {
+			// process gone meanwhile
+			continue
+		}
+		tree[st.Ppid] = append(tree[st.Ppid], st.Pid)
+	}
+	return tree, nil
+}
+
+func (t Tree) Children(pid int32) []int32 {
+	return t[pid]
+}
+
+// Descendants returns all the processes below the given one, children first.
+func (t Tree) Descendants(pid int32) []int32 {
+	var descs []int32
+	queue := append([]int32{}, t[pid]...)
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		descs = append(descs, cur)
+		queue = append(queue, t[cur]...)
+	}
+	return descs
+}
@@ -0,0 +1,24 @@
+package procfs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTreeDescendants(t *testing.T) {
+	tree := Tree{
+		1:  {10, 20},
+		10: {11, 12},
+		12: {13},
+		20: {21},
+	}
+	if got := tree.Children(10); !reflect.DeepEqual(got, []int32{11, 12}) {
+		t.Errorf("unexpected children: %v", got)
+	}
+	if got := tree.Descendants(10); !reflect.DeepEqual(got, []int32{11, 12, 13}) {
+		t.Errorf("unexpected descendants: %v", got)
+	}
+	if got := tree.Descendants(13); len(got) != 0 {
+		t.Errorf("unexpected descendants: %v", got)
+	}
+}
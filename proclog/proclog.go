@@ -0,0 +1,295 @@
+// Package proclog is a leveled, structured logger. Each subsystem
+// (procfind, procnotify, podfind...) has its own level, and the records
+// are written as text or as JSON lines.
+package proclog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrUnknownLevel  = errors.New("unknown log level")
+	ErrUnknownFormat = errors.New("unknown log format")
+)
+
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarning
+	LevelError
+)
+
+var levelNames = []string{"debug", "info", "warning", "error"}
+
+func (l Level) String() string {
+	if l < LevelDebug || l > LevelError {
+		return strconv.Itoa(int(l))
+	}
+	return levelNames[l]
+}
+
+func ParseLevel(s string) (Level, error) {
+	for idx, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return Level(idx), nil
+		}
+	}
+	if strings.EqualFold(s, "warn") {
+		return LevelWarning, nil
+	}
+	return LevelInfo, ErrUnknownLevel
+}
+
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Config configures the logging. The zero value logs text at info level.
+type Config struct {
+	// Format is FormatText (default) or FormatJSON
+	Format string `json:"format"`
+	// Level is the level of the subsystems not listed in Subsystems
+	Level string `json:"level"`
+	// Subsystems maps the subsystems to their own level
+	Subsystems map[string]string `json:"subsystems"`
+}
+
+// ParseLevels parses a comma separated list of levels, like
+// "info,podfind=debug", into the configuration: items without
+// a subsystem set the default level.
+func (c *Config) ParseLevels(s string) error {
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) == 1 {
+			c.Level = kv[0]
+			continue
+		}
+		if c.Subsystems == nil {
+			c.Subsystems = make(map[string]string)
+		}
+		c.Subsystems[kv[0]] = kv[1]
+	}
+	return c.Validate()
+}
+
+func (c Config) Validate() error {
+	if c.Format != "" && c.Format != FormatText && c.Format != FormatJSON {
+		return ErrUnknownFormat
+	}
+	if c.Level != "" {
+		if _, err := ParseLevel(c.Level); err != nil {
+			return err
+		}
+	}
+	for _, level := range c.Subsystems {
+		if _, err := ParseLevel(level); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// output is shared by all the loggers.
+type output struct {
+	lock       sync.Mutex
+	w          io.Writer
+	json       bool
+	level      Level
+	subsystems map[string]Level
+	// now is replaced by the tests
+	now func() time.Time
+}
+
+var out = &output{
+	w:     os.Stderr,
+	level: LevelInfo,
+	now:   time.Now,
+}
+
+// Setup applies the configuration, and sends the records to w.
+func Setup(conf Config, w io.Writer) error {
+	err := conf.Validate()
+	if err != nil {
+		return err
+	}
+	out.lock.Lock()
+	defer out.lock.Unlock()
+	out.w = w
+	out.json = conf.Format == FormatJSON
+	out.level = LevelInfo
+	if conf.Level != "" {
+		out.level, _ = ParseLevel(conf.Level)
+	}
+	out.subsystems = make(map[string]Level)
+	for name, level := range conf.Subsystems {
+		out.subsystems[name], _ = ParseLevel(level)
+	}
+	return nil
+}
+
+func (o *output) enabled(subsystem string, level Level) bool {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	min, ok := o.subsystems[subsystem]
+	if !ok {
+		min = o.level
+	}
+	return level >= min
+}
+
+func (o *output) write(subsystem string, level Level, msg string, kvs []interface{}) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	now := o.now()
+	if o.json {
+		rec := map[string]interface{}{
+			"time":      now.Format(time.RFC3339Nano),
+			"level":     level.String(),
+			"subsystem": subsystem,
+			"msg":       msg,
+		}
+		for idx := 0; idx+1 < len(kvs); idx += 2 {
+			val := kvs[idx+1]
+			switch v := val.(type) {
+			case error:
+				val = v.Error()
+			case time.Duration:
+				val = v.String()
+			}
+			rec[fmt.Sprint(kvs[idx])] = val
+		}
+		data, err := json.Marshal(rec)
+		if err != nil {
+			data, _ = json.Marshal(map[string]string{"msg": msg, "error": err.Error()})
+		}
+		o.w.Write(append(data, '\n'))
+		return
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s %-7s %s: %s", now.Format("2006-01-02T15:04:05.000Z07:00"), strings.ToUpper(level.String()), subsystem, msg)
+	for idx := 0; idx+1 < len(kvs); idx += 2 {
+		fmt.Fprintf(&sb, " %v=%s", kvs[idx], quote(fmt.Sprint(kvs[idx+1])))
+	}
+	sb.WriteByte('\n')
+	io.WriteString(o.w, sb.String())
+}
+
+func quote(s string) string {
+	if s == "" || strings.ContainsAny(s, " \t\n\"=") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// Logger logs the records of a subsystem. The arguments after the message
+// are key-value pairs.
+type Logger struct {
+	subsystem string
+	limiter   *limiter
+}
+
+func New(subsystem string) *Logger {
+	return &Logger{subsystem: subsystem}
+}
+
+// Enabled tells if the records of the given level are logged, to skip
+// building expensive ones.
+func (l *Logger) Enabled(level Level) bool {
+	return out.enabled(l.subsystem, level)
+}
+
+func (l *Logger) Log(level Level, msg string, kvs ...interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+	if l.limiter != nil {
+		suppressed, ok := l.limiter.allow(msg, out.now())
+		if !ok {
+			return
+		}
+		if suppressed > 0 {
+			kvs = append(kvs, "suppressed", suppressed)
+		}
+	}
+	out.write(l.subsystem, level, msg, kvs)
+}
+
+func (l *Logger) Debug(msg string, kvs ...interface{}) {
+	l.Log(LevelDebug, msg, kvs...)
+}
+
+func (l *Logger) Info(msg string, kvs ...interface{}) {
+	l.Log(LevelInfo, msg, kvs...)
+}
+
+func (l *Logger) Warning(msg string, kvs ...interface{}) {
+	l.Log(LevelWarning, msg, kvs...)
+}
+
+func (l *Logger) Error(msg string, kvs ...interface{}) {
+	l.Log(LevelError, msg, kvs...)
+}
+
+// Fatal logs an error record, and exits.
+func (l *Logger) Fatal(msg string, kvs ...interface{}) {
+	out.write(l.subsystem, LevelError, msg, kvs)
+	os.Exit(1)
+}
+
+// Limit returns a logger which logs each message at most once per interval,
+// however the values differ. The count of the records dropped meanwhile is
+// added to the next one logged.
+func (l *Logger) Limit(interval time.Duration) *Logger {
+	return &Logger{
+		subsystem: l.subsystem,
+		limiter: &limiter{
+			interval: interval,
+			seen:     make(map[string]*limitState),
+		},
+	}
+}
+
+type limitState struct {
+	last       time.Time
+	suppressed int
+}
+
+type limiter struct {
+	lock     sync.Mutex
+	interval time.Duration
+	seen     map[string]*limitState
+}
+
+func (lm *limiter) allow(msg string, now time.Time) (int, bool) {
+	lm.lock.Lock()
+	defer lm.lock.Unlock()
+	st, ok := lm.seen[msg]
+	if !ok {
+		lm.seen[msg] = &limitState{last: now}
+		return 0, true
+	}
+	if now.Sub(st.last) < lm.interval {
+		st.suppressed++
+		return 0, false
+	}
+	suppressed := st.suppressed
+	st.last = now
+	st.suppressed = 0
+	return suppressed, true
+}
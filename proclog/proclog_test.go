@@ -0,0 +1,116 @@
+package proclog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func setupTest(t *testing.T, conf Config) (*bytes.Buffer, *time.Time) {
+	var buf bytes.Buffer
+	err := Setup(conf, &buf)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	now := time.Date(2018, 11, 20, 10, 0, 0, 0, time.UTC)
+	out.now = func() time.Time { return now }
+	return &buf, &now
+}
+
+func resetTest() {
+	Setup(Config{}, os.Stderr)
+	out.now = time.Now
+}
+
+func TestText(t *testing.T) {
+	buf, _ := setupTest(t, Config{})
+	defer resetTest()
+
+	l := New("procnotify")
+	l.Info("new PID", "target", "vdsm", "pid", 4615)
+	l.Warning("cannot post the notification", "error", errors.New("connection refused"))
+	l.Debug("updated")
+
+	expected := "2018-11-20T10:00:00.000Z INFO    procnotify: new PID target=vdsm pid=4615\n" +
+		"2018-11-20T10:00:00.000Z WARNING procnotify: cannot post the notification error=\"connection refused\"\n"
+	if buf.String() != expected {
+		t.Errorf("mismatch:\ngot\n%s\nexpected\n%s", buf.String(), expected)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	buf, _ := setupTest(t, Config{Format: FormatJSON})
+	defer resetTest()
+
+	New("procnotify").Info("tick overrun", "took", 1500*time.Millisecond, "skipped", 1)
+	var rec map[string]interface{}
+	err := json.Unmarshal(buf.Bytes(), &rec)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := map[string]interface{}{
+		"time":      "2018-11-20T10:00:00Z",
+		"level":     "info",
+		"subsystem": "procnotify",
+		"msg":       "tick overrun",
+		"took":      "1.5s",
+		"skipped":   float64(1),
+	}
+	for key, val := range expected {
+		if rec[key] != val {
+			t.Errorf("mismatch on %s: got %#v expected %#v", key, rec[key], val)
+		}
+	}
+}
+
+func TestSubsystemLevels(t *testing.T) {
+	conf := Config{}
+	err := conf.ParseLevels("warning,podfind=debug")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	buf, _ := setupTest(t, conf)
+	defer resetTest()
+
+	New("podfind").Debug("pod")
+	New("procnotify").Info("new PID")
+	New("procnotify").Error("stale pid(s), stopping")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], "podfind: pod") || !strings.Contains(lines[1], "stopping") {
+		t.Errorf("unexpected records: %q", lines)
+	}
+
+	err = conf.ParseLevels("podfind=verbose")
+	if err != ErrUnknownLevel {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestLimit(t *testing.T) {
+	buf, now := setupTest(t, Config{})
+	defer resetTest()
+
+	l := New("procnotify").Limit(time.Minute)
+	for i := 1; i <= 5; i++ {
+		l.Warning("cannot post the notification", "error", "connection refused")
+		*now = now.Add(10 * time.Second)
+	}
+	l.Warning("tick overrun", "skipped", 1)
+	*now = now.Add(10 * time.Second)
+	l.Warning("cannot post the notification", "error", "timeout")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("unexpected records: %q", lines)
+	}
+	if !strings.HasSuffix(lines[0], "error=\"connection refused\"") ||
+		!strings.HasSuffix(lines[1], "skipped=1") ||
+		!strings.HasSuffix(lines[2], "error=timeout suppressed=4") {
+		t.Errorf("unexpected records: %q", lines)
+	}
+}
@@ -0,0 +1,109 @@
+package procnotify
+
+import (
+	"fmt"
+	"math"
+)
+
+// aggregatedMetrics are the per-process metrics rolled up per target.
+var aggregatedMetrics = []string{
+	"percent-cpu",
+	"memory-resident",
+	"memory-proportional",
+}
+
+type rollup struct {
+	count int
+	sum   float64
+	min   float64
+	max   float64
+}
+
+func (r *rollup) add(value float64) {
+	if r.count == 0 {
+		r.min = value
+		r.max = value
+	} else {
+		r.min = math.Min(r.min, value)
+		r.max = math.Max(r.max, value)
+	}
+	r.count++
+	r.sum += value
+}
+
+// aggregate adds to the samples the rollups of the due targets which
+// asked for them, and drops the per-process samples of the targets which
+// want only the rollups.
+func (notif *Notifier) aggregate(hostname string, due map[*Target]bool, items []Sample) []Sample {
+	targets := make(map[string]*Target)
+	for target := range due {
+		if target.Aggregate || target.AggregateOnly {
+			targets[target.Name] = target
+		}
+	}
+	if len(targets) == 0 {
+		return items
+	}
+
+	pids := make(map[string]map[int32]bool)
+	rollups := make(map[string]map[string]*rollup)
+	var kept []Sample
+	for _, item := range items {
+		target, ok := targets[item.Target]
+		if !ok {
+			kept = append(kept, item)
+			continue
+		}
+		if !target.AggregateOnly {
+			kept = append(kept, item)
+		}
+		// the rollups are per matched process: the descendants count
+		// only through sum_children
+		if item.Parent != 0 {
+			continue
+		}
+
+		if pids[item.Target] == nil {
+			pids[item.Target] = make(map[int32]bool)
+			rollups[item.Target] = make(map[string]*rollup)
+		}
+		pids[item.Target][item.Pid] = true
+		for _, name := range aggregatedMetrics {
+			if item.Name != name {
+				continue
+			}
+			r, ok := rollups[item.Target][name]
+			if !ok {
+				r = &rollup{}
+				rollups[item.Target][name] = r
+			}
+			r.add(item.Value)
+		}
+	}
+
+	now := notif.now()
+	for _, target := range notif.targets {
+		if _, ok := targets[target.Name]; !ok {
+			continue
+		}
+		s := &samples{
+			target:   target.Name,
+			ident:    fmt.Sprintf("%s/exec-%s-aggregate", hostname, target.Name),
+			interval: int(target.interval.Seconds()),
+			time:     now,
+		}
+		s.add("count-processes", float64(len(pids[target.Name])))
+		for _, name := range aggregatedMetrics {
+			r, ok := rollups[target.Name][name]
+			if !ok {
+				continue
+			}
+			s.add(name+"_sum", r.sum)
+			s.add(name+"_min", r.min)
+			s.add(name+"_max", r.max)
+			s.add(name+"_avg", r.sum/float64(r.count))
+		}
+		kept = append(kept, s.items...)
+	}
+	return kept
+}
@@ -0,0 +1,89 @@
+package procnotify
+
+import (
+	"testing"
+)
+
+func TestAggregate(t *testing.T) {
+	notif := NewNotifier([]Config{
+		{Name: "qemu", Argv: []string{"qemu"}, AggregateOnly: true},
+		{Name: "libvirtd", Argv: []string{"libvirtd"}},
+	}, nil, "")
+	notif.Schedule(0)
+	due := map[*Target]bool{notif.targets[0]: true, notif.targets[1]: true}
+
+	items := []Sample{
+		{Target: "qemu", Pid: 10, Name: "percent-cpu", Value: 10},
+		{Target: "qemu", Pid: 10, Name: "memory-resident", Value: 1024},
+		{Target: "qemu", Pid: 11, Name: "percent-cpu", Value: 30},
+		{Target: "qemu", Pid: 11, Name: "memory-resident", Value: 2048},
+		{Target: "libvirtd", Pid: 1, Name: "percent-cpu", Value: 5},
+	}
+	got := make(map[string]float64)
+	for _, item := range notif.aggregate("host", due, items) {
+		if item.Target == "qemu" && item.Ident != "host/exec-qemu-aggregate" {
+			t.Errorf("unexpected per-process sample: %v", item)
+		}
+		got[item.Target+"/"+item.Name] = item.Value
+	}
+
+	expected := map[string]float64{
+		"libvirtd/percent-cpu":     5,
+		"qemu/count-processes":     2,
+		"qemu/percent-cpu_sum":     40,
+		"qemu/percent-cpu_min":     10,
+		"qemu/percent-cpu_max":     30,
+		"qemu/percent-cpu_avg":     20,
+		"qemu/memory-resident_sum": 3072,
+		"qemu/memory-resident_min": 1024,
+		"qemu/memory-resident_max": 2048,
+		"qemu/memory-resident_avg": 1536,
+	}
+	if len(got) != len(expected) {
+		t.Errorf("unexpected samples: %v", got)
+	}
+	for key, val := range expected {
+		if got[key] != val {
+			t.Errorf("mismatch for %s: got %v expected %v", key, got[key], val)
+		}
+	}
+}
+
+func TestAggregateChildren(t *testing.T) {
+	notif := NewNotifier([]Config{
+		{Name: "qemu", Argv: []string{"qemu"}, Aggregate: true, IncludeChildren: true},
+	}, nil, "")
+	notif.Schedule(0)
+	due := map[*Target]bool{notif.targets[0]: true}
+
+	items := []Sample{
+		{Target: "qemu", Pid: 10, Name: "percent-cpu", Value: 10},
+		{Target: "qemu", Pid: 11, Name: "percent-cpu", Value: 30},
+		{Target: "qemu", Pid: 12, Parent: 10, Name: "percent-cpu", Value: 2},
+		{Target: "qemu", Pid: 13, Parent: 11, Name: "percent-cpu", Value: 4},
+	}
+	got := make(map[string]float64)
+	children := 0
+	for _, item := range notif.aggregate("host", due, items) {
+		if item.Parent != 0 {
+			children++
+		}
+		got[item.Name] = item.Value
+	}
+	if children != 2 {
+		t.Errorf("mismatch: %d child samples expected 2", children)
+	}
+
+	expected := map[string]float64{
+		"count-processes": 2,
+		"percent-cpu_sum": 40,
+		"percent-cpu_min": 10,
+		"percent-cpu_max": 30,
+		"percent-cpu_avg": 20,
+	}
+	for key, val := range expected {
+		if got[key] != val {
+			t.Errorf("mismatch for %s: got %v expected %v", key, got[key], val)
+		}
+	}
+}
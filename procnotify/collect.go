@@ -0,0 +1,132 @@
+package procnotify
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const DefaultWorkers = 4
+
+// Stats reports how the collection loop is keeping up with its schedule.
+type Stats struct {
+	// Started is when the collection loop started
+	Started      time.Time `json:"started"`
+	Ticks        uint64    `json:"ticks"`
+	Overruns     uint64    `json:"overruns"`
+	SkippedTicks uint64    `json:"skipped_ticks"`
+	// Timeouts counts the processes not collected within the tick deadline.
+	Timeouts     uint64        `json:"timeouts"`
+	LastTick     time.Time     `json:"last_tick"`
+	LastDuration time.Duration `json:"last_duration"`
+}
+
+type statsKeeper struct {
+	lock  sync.Mutex
+	stats Stats
+}
+
+func (sk *statsKeeper) start(now time.Time) {
+	sk.lock.Lock()
+	defer sk.lock.Unlock()
+	sk.stats.Started = now
+}
+
+func (sk *statsKeeper) tickDone(now time.Time, elapsed time.Duration, timeouts int) {
+	sk.lock.Lock()
+	defer sk.lock.Unlock()
+	sk.stats.Ticks++
+	sk.stats.Timeouts += uint64(timeouts)
+	sk.stats.LastTick = now
+	sk.stats.LastDuration = elapsed
+}
+
+func (sk *statsKeeper) overrun(skipped int) {
+	sk.lock.Lock()
+	defer sk.lock.Unlock()
+	sk.stats.Overruns++
+	sk.stats.SkippedTicks += uint64(skipped)
+}
+
+func (notif *Notifier) Stats() Stats {
+	notif.stats.lock.Lock()
+	defer notif.stats.lock.Unlock()
+	return notif.stats.stats
+}
+
+func (notif *Notifier) collectContext(parent context.Context, now time.Time) (context.Context, context.CancelFunc) {
+	budget := notif.Deadline
+	if budget == 0 {
+		budget = notif.tick
+	}
+	if budget <= 0 {
+		return context.WithCancel(parent)
+	}
+	return context.WithDeadline(parent, now.Add(budget))
+}
+
+// collectAll collects the given processes using a bounded pool of workers.
+// Processes not collected before the context expires are skipped; their
+// count is returned alongside the samples which were collected in time.
+// The workers are all done when collectAll returns, so they never outlive
+// the tick.
+func (notif *Notifier) collectAll(ctx context.Context, hostname string, procs []Proc) ([]Sample, int) {
+	workers := notif.Workers
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+	if workers > len(procs) {
+		workers = len(procs)
+	}
+
+	var lock sync.Mutex
+	results := make([][]Sample, len(procs))
+	completed := make([]bool, len(procs))
+
+	jobs := make(chan int)
+	go func() {
+		defer close(jobs)
+		for idx := range procs {
+			select {
+			case jobs <- idx:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range jobs {
+				items, err := notif.collect(ctx, procs[idx], hostname)
+				if err == ctx.Err() && err != nil {
+					// abandoned, counted as missed
+					continue
+				}
+				if err != nil {
+					throttled.Warning("cannot collect the process", "target", procs[idx].t.Name, "pid", procs[idx].p.Pid, "error", err)
+				}
+				lock.Lock()
+				results[idx] = items
+				completed[idx] = true
+				lock.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	var items []Sample
+	missed := 0
+	for idx := range procs {
+		if !completed[idx] {
+			missed++
+			continue
+		}
+		items = append(items, results[idx]...)
+	}
+	return items, missed
+}
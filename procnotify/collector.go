@@ -0,0 +1,75 @@
+package procnotify
+
+import (
+	"context"
+	"time"
+)
+
+// Batch is what a collection produces.
+type Batch struct {
+	// Time is the time the collection ran for
+	Time    time.Time `json:"time"`
+	Samples []Sample  `json:"samples"`
+	Events  []Event   `json:"events,omitempty"`
+}
+
+// Collect collects the targets which are due, after rescanning if the
+// tracked processes changed, and returns the samples and the events
+// instead of sending them to the sink.
+func (notif *Notifier) Collect(ctx context.Context, hostname string) (Batch, error) {
+	return notif.step(ctx, hostname, notif.now(), true)
+}
+
+// Subscribe runs the collection loop, and delivers the batches on the
+// returned channel instead of sending them to the sink. The loop stops,
+// and the channel is closed, once ctx is done, or once the tracked
+// processes go stale and autoTrack is false. Without a positive interval,
+// for the targets or the whole loop, the channel is closed right away.
+func (notif *Notifier) Subscribe(ctx context.Context, hostname string, interval time.Duration, autoTrack bool) <-chan Batch {
+	tick := notif.Schedule(interval)
+	batches := make(chan Batch)
+	if tick <= 0 {
+		logger.Error("cannot start the collection", "tick", tick)
+		close(batches)
+		return batches
+	}
+	notif.stats.start(time.Now())
+	go notif.loop(ctx, hostname, tick, autoTrack, batches)
+	return batches
+}
+
+func (notif *Notifier) loop(ctx context.Context, hostname string, tick time.Duration, autoTrack bool, batches chan<- Batch) {
+	defer close(batches)
+	tk := newTicker(tick, time.Now())
+
+	logger.Info("collection started", "tick", tick)
+	defer logger.Info("collection stopped")
+
+	err := notif.Rescan()
+	if err != nil {
+		logger.Error("cannot set up the collection", "error", err)
+	}
+
+	for {
+		now, ok := tk.wait(ctx)
+		if !ok {
+			return
+		}
+		batch, err := notif.step(ctx, hostname, now, autoTrack)
+		if err == ErrStalePids {
+			return
+		}
+		if err == nil {
+			select {
+			case batches <- batch:
+			case <-ctx.Done():
+				return
+			}
+		}
+		skipped := tk.advance(time.Now())
+		if skipped > 0 {
+			throttled.Warning("tick overrun", "took", time.Since(now), "skipped", skipped)
+			notif.stats.overrun(skipped)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package procnotify
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Duration is a time.Duration which can be read from JSON either as
+// a number of seconds (like the legacy configuration files do) or as
+// a string parsable by time.ParseDuration.
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var val interface{}
+	err := json.Unmarshal(data, &val)
+	if err != nil {
+		return err
+	}
+	switch v := val.(type) {
+	case float64:
+		d.Duration = time.Duration(v * float64(time.Second))
+	case string:
+		d.Duration, err = time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+	case nil:
+		d.Duration = 0
+	default:
+		return fmt.Errorf("invalid duration: %s", string(data))
+	}
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (c Config) Validate() error {
+	if len(c.Argv) == 0 {
+		return fmt.Errorf("target %q: missing argv", c.Name)
+	}
+	if c.Interval.Duration < 0 {
+		return fmt.Errorf("target %q: negative interval: %v", c.Name, c.Interval)
+	}
+	for _, group := range c.Metrics {
+		if _, ok := collectors[group]; !ok && group != MetricsContainer {
+			return fmt.Errorf("target %q: unknown metrics group: %q", c.Name, group)
+		}
+	}
+	if c.Min < 0 || c.Max < 0 || (c.Max > 0 && c.Max < c.Min) {
+		return fmt.Errorf("target %q: invalid expected instances: [%d, %d]", c.Name, c.Min, c.Max)
+	}
+	for _, rule := range c.Rules {
+		if err := rule.Validate(); err != nil {
+			return fmt.Errorf("target %q: %v", c.Name, err)
+		}
+	}
+	if c.LeakDetection != nil {
+		if err := c.LeakDetection.Validate(); err != nil {
+			return fmt.Errorf("target %q: %v", c.Name, err)
+		}
+	}
+	switch c.ThreadBreakdown {
+	case "", ThreadBreakdownThread, ThreadBreakdownComm:
+	default:
+		return fmt.Errorf("target %q: unknown thread breakdown: %q", c.Name, c.ThreadBreakdown)
+	}
+	return nil
+}
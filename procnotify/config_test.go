@@ -0,0 +1,62 @@
+package procnotify
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestDurationUnmarshal(t *testing.T) {
+	type testcase struct {
+		data     string
+		expected time.Duration
+	}
+	testcases := []testcase{
+		{
+			data:     `{"name": "libvirtd", "interval": 5}`,
+			expected: 5 * time.Second,
+		},
+		{
+			data:     `{"name": "vdsm", "interval": "2s"}`,
+			expected: 2 * time.Second,
+		},
+		{
+			data:     `{"name": "qemu", "interval": "1m30s"}`,
+			expected: 90 * time.Second,
+		},
+		{
+			data:     `{"name": "qemu"}`,
+			expected: 0,
+		},
+	}
+
+	for _, tcase := range testcases {
+		var conf Config
+		err := json.Unmarshal([]byte(tcase.data), &conf)
+		if err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+		if conf.Interval.Duration != tcase.expected {
+			t.Errorf("mismatch: got %v for %#v", conf.Interval, tcase)
+		}
+	}
+}
+
+func TestDurationUnmarshalInvalid(t *testing.T) {
+	var conf Config
+	err := json.Unmarshal([]byte(`{"interval": "forever"}`), &conf)
+	if err == nil {
+		t.Errorf("unexpected success: %#v", conf)
+	}
+}
+
+func TestValidateUnknownMetrics(t *testing.T) {
+	conf := Config{
+		Name:    "qemu",
+		Argv:    []string{"/usr/*/qemu*"},
+		Metrics: []string{MetricsCPU, "gpu"},
+	}
+	if err := conf.Validate(); err == nil {
+		t.Errorf("unexpected success: %#v", conf)
+	}
+}
@@ -0,0 +1,97 @@
+package procnotify
+
+import (
+	"github.com/fromanirh/procwatch/cgroups"
+	"github.com/fromanirh/procwatch/podfind"
+
+	"context"
+	"fmt"
+)
+
+// containerIDLen is the length of the container IDs in the identifiers,
+// like the short IDs docker shows.
+const containerIDLen = 12
+
+func hasMetrics(t *Target, group string) bool {
+	for _, g := range t.Metrics {
+		if g == group {
+			return true
+		}
+	}
+	return false
+}
+
+// containerSamples reports the accounting of the containers the given
+// processes run into, once per container, under "container-<id>": processes
+// sharing a container would report the same values. The first target
+// collecting a container owns its series.
+func (notif *Notifier) containerSamples(ctx context.Context, hostname string, procs []Proc) ([]Sample, error) {
+	var items []Sample
+	seen := make(map[string]bool)
+	for _, proc := range procs {
+		if !hasMetrics(proc.t, MetricsContainer) {
+			continue
+		}
+		id, cgroupStyle := podfind.FindContainerIDByCGroup(proc.p.Pid)
+		if cgroupStyle != podfind.DockerCGroup || seen[id] {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return items, err
+		}
+		seen[id] = true
+		short := id
+		if len(short) > containerIDLen {
+			short = short[:containerIDLen]
+		}
+		s := &samples{
+			target:   proc.t.Name,
+			ident:    fmt.Sprintf("%s/container-%s", hostname, short),
+			interval: int(proc.t.interval.Seconds()),
+			time:     notif.now(),
+		}
+		err := collectContainer(proc, s)
+		if err != nil {
+			// gone meanwhile, the other processes may still be there
+			seen[id] = false
+			throttled.Warning("cannot collect the container", "target", proc.t.Name, "container", short, "error", err)
+			continue
+		}
+		items = append(items, s.items...)
+	}
+	return items, nil
+}
+
+func collectContainer(proc Proc, s *samples) error {
+	entries, err := cgroups.ReadProcCGroups(proc.p.Pid)
+	if err != nil {
+		return err
+	}
+	st, err := cgroups.ReadStats(entries)
+	if err != nil {
+		return err
+	}
+
+	s.add("derive-container_cpu_usage_us", float64(st.CPU.UsageUsec))
+	s.add("derive-container_cpu_periods", float64(st.CPU.Periods))
+	s.add("derive-container_cpu_throttled_periods", float64(st.CPU.ThrottledPeriods))
+	s.add("derive-container_cpu_throttled_us", float64(st.CPU.ThrottledTimeUsec))
+
+	if st.Memory.Current != cgroups.Unlimited {
+		s.add("memory-container_usage", float64(st.Memory.Current/1024))
+	}
+	if st.Memory.Max != cgroups.Unlimited {
+		s.add("memory-container_limit", float64(st.Memory.Max/1024))
+	}
+	// v1 has no count of the OOM events, only of the kills
+	if st.Version != 1 {
+		s.add("derive-container_oom", float64(st.Memory.OOM))
+	}
+	s.add("derive-container_oom_kill", float64(st.Memory.OOMKill))
+
+	s.add("total_bytes-container_read", float64(st.IO.ReadBytes))
+	s.add("total_bytes-container_write", float64(st.IO.WriteBytes))
+	s.add("total_operations-container_read", float64(st.IO.ReadIOs))
+	s.add("total_operations-container_write", float64(st.IO.WriteIOs))
+	return nil
+}
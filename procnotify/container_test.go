@@ -0,0 +1,87 @@
+package procnotify
+
+import (
+	"github.com/fromanirh/procwatch/cgroups"
+	"github.com/fromanirh/procwatch/procfs/procfstest"
+
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const containerID = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+func writeContainerCGroup(t *testing.T, root string) {
+	dir := filepath.Join(root, "system.slice", "docker-"+containerID+".scope")
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	files := map[string]string{
+		filepath.Join(root, "cgroup.controllers"): "cpu memory io\n",
+		filepath.Join(dir, "cpu.stat"):            "usage_usec 2000\nnr_periods 10\nnr_throttled 3\nthrottled_usec 750\n",
+		filepath.Join(dir, "memory.current"):      "8192\n",
+		filepath.Join(dir, "memory.max"):          "max\n",
+		filepath.Join(dir, "memory.events"):       "oom 2\noom_kill 1\n",
+		filepath.Join(dir, "io.stat"):             "8:0 rbytes=100 wbytes=200 rios=1 wios=2\n",
+	}
+	for path, content := range files {
+		err = ioutil.WriteFile(path, []byte(content), 0644)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+}
+
+func TestContainerSamples(t *testing.T) {
+	fs := procfstest.New(t)
+	defer fs.Remove()
+	defer fs.Use()()
+	cgroup := "0::/system.slice/docker-" + containerID + ".scope\n"
+	fs.Add(procfstest.Proc{Pid: 2159, PPid: 1, Argv: []string{"/usr/bin/httpd"}, CGroup: cgroup})
+	fs.Add(procfstest.Proc{Pid: 2160, PPid: 2159, Argv: []string{"/usr/bin/httpd"}, CGroup: cgroup})
+
+	root := filepath.Join(fs.Root, "cgroup")
+	writeContainerCGroup(t, root)
+	oldRoot := cgroups.Root
+	cgroups.Root = root
+	defer func() { cgroups.Root = oldRoot }()
+
+	notif := NewNotifier([]Config{
+		{Name: "httpd", Argv: []string{"/usr/bin/httpd"}, Metrics: []string{MetricsContainer}},
+	}, nil, "")
+	err := notif.Scan()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var procs []Proc
+	for _, proc := range notif.procs {
+		procs = append(procs, proc)
+	}
+	if len(procs) != 2 {
+		t.Fatalf("mismatch: %d processes expected 2", len(procs))
+	}
+	items, err := notif.containerSamples(context.Background(), "node0", procs)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	values := make(map[string]float64)
+	for _, item := range items {
+		if item.Ident != "node0/container-0123456789ab" {
+			t.Errorf("unexpected ident: %s", item.Ident)
+		}
+		if _, ok := values[item.Name]; ok {
+			t.Errorf("duplicate series: %s", item.Name)
+		}
+		values[item.Name] = item.Value
+	}
+	if values["memory-container_usage"] != 8 || values["derive-container_oom"] != 2 {
+		t.Errorf("mismatch: %v", values)
+	}
+	if _, ok := values["memory-container_limit"]; ok {
+		t.Errorf("unexpected limit: %v", values)
+	}
+}
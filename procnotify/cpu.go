@@ -0,0 +1,74 @@
+package procnotify
+
+import (
+	"github.com/fromanirh/procwatch/procfs"
+	"github.com/shirou/gopsutil/cpu"
+
+	"runtime"
+	"sync"
+	"time"
+)
+
+type cpuTimes struct {
+	created int64
+	total   float64
+	at      time.Time
+}
+
+// cpuTracker remembers the CPU time consumed by each process across
+// collections and rescans, so the utilization can be computed over the
+// actual interval elapsed between two samples.
+type cpuTracker struct {
+	lock  sync.Mutex
+	times map[int32]cpuTimes
+	ncpu  int
+}
+
+func newCPUTracker() *cpuTracker {
+	ncpu, err := procfs.NumCPU()
+	if err != nil {
+		ncpu, err = cpu.Counts(true)
+	}
+	if err != nil || ncpu <= 0 {
+		ncpu = runtime.NumCPU()
+	}
+	return &cpuTracker{
+		times: make(map[int32]cpuTimes),
+		ncpu:  ncpu,
+	}
+}
+
+// update records the CPU time (in seconds) consumed by the process so far,
+// and returns the CPU utilization since the previous update, as percentage
+// of one CPU. Returns false if there is no previous update to compare to,
+// or if the PID was reused by another process in the meantime.
+func (ct *cpuTracker) update(pid int32, created int64, total float64, at time.Time) (float64, bool) {
+	ct.lock.Lock()
+	defer ct.lock.Unlock()
+
+	prev, ok := ct.times[pid]
+	ct.times[pid] = cpuTimes{
+		created: created,
+		total:   total,
+		at:      at,
+	}
+	if !ok || prev.created != created {
+		return 0, false
+	}
+	elapsed := at.Sub(prev.at).Seconds()
+	if elapsed <= 0 || total < prev.total {
+		return 0, false
+	}
+	return 100 * (total - prev.total) / elapsed, true
+}
+
+// prune forgets the processes no longer tracked.
+func (ct *cpuTracker) prune(procs map[int32]Proc) {
+	ct.lock.Lock()
+	defer ct.lock.Unlock()
+	for pid := range ct.times {
+		if _, ok := procs[pid]; !ok {
+			delete(ct.times, pid)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package procnotify
+
+import (
+	"github.com/fromanirh/procwatch/procfs/procfstest"
+	"github.com/shirou/gopsutil/process"
+
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCPUTrackerUpdate(t *testing.T) {
+	ct := &cpuTracker{times: make(map[int32]cpuTimes), ncpu: 4}
+	start := time.Now()
+
+	if _, ok := ct.update(42, 1000, 10.0, start); ok {
+		t.Errorf("unexpected utilization on first sample")
+	}
+
+	perc, ok := ct.update(42, 1000, 10.5, start.Add(2*time.Second))
+	if !ok {
+		t.Errorf("missing utilization on second sample")
+	}
+	if perc != 25.0 {
+		t.Errorf("unexpected utilization: %v", perc)
+	}
+
+	// same PID, different process
+	if _, ok := ct.update(42, 2000, 0.1, start.Add(4*time.Second)); ok {
+		t.Errorf("unexpected utilization after PID reuse")
+	}
+}
+
+func TestCPUTrackerPrune(t *testing.T) {
+	ct := &cpuTracker{times: make(map[int32]cpuTimes), ncpu: 1}
+	now := time.Now()
+	ct.update(1, 1000, 1.0, now)
+	ct.update(2, 1000, 1.0, now)
+
+	ct.prune(map[int32]Proc{2: Proc{}})
+	if _, ok := ct.times[1]; ok {
+		t.Errorf("stale pid not pruned")
+	}
+	if _, ok := ct.times[2]; !ok {
+		t.Errorf("live pid pruned")
+	}
+}
+
+func TestCollectCPUTimes(t *testing.T) {
+	fs := procfstest.New(t)
+	defer fs.Remove()
+	defer fs.Use()()
+	fs.Add(procfstest.Proc{Pid: 2159, PPid: 1, Argv: []string{"/usr/bin/python2"}, UTime: 5, STime: 3})
+	// an older kernel, without delayacct_blkio_ticks nor guest_time
+	old := "2192 (sh) S 1 2192 2192 0 -1 4202816 10 0 0 0 5 3 0 0 20 0 1 0 3941 1000 10 100 1 1 0 0 0 0 0 0 0 0 0 0 17 3 0 0\n"
+	fs.Add(procfstest.Proc{Pid: 2192, PPid: 1, Argv: []string{"/bin/sh"}})
+	err := ioutil.WriteFile(filepath.Join(fs.Root, "2192", "stat"), []byte(old), 0644)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	notif := NewNotifier(nil, nil, "")
+	for pid, expected := range map[int32]int{2159: 4, 2192: 2} {
+		s := &samples{time: time.Now()}
+		err = collectCPU(notif, Proc{p: &process.Process{Pid: pid}}, s)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		var names []string
+		for _, item := range s.items {
+			names = append(names, item.Name)
+		}
+		if len(names) != expected || names[0] != "cpu-user" || names[1] != "cpu-system" {
+			t.Errorf("mismatch for %d: %v", pid, names)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package procnotify
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// minHealthWindow is the least time the loop may go without completing
+// a tick before being considered stuck, to tolerate short hiccups.
+const minHealthWindow = 30 * time.Second
+
+// Health tells whether the Notifier is working, and why not.
+type Health struct {
+	// Live is false if the collection loop is stuck
+	Live bool `json:"live"`
+	// Ready is false if the collection loop is stuck or not yet started,
+	// the sink refuses data or the pod resolution is not working
+	Ready   bool     `json:"ready"`
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+// podState has its own lock, so the health checks don't wait
+// for a CRI call in progress.
+type podState struct {
+	lock    sync.Mutex
+	begin   time.Time
+	done    time.Time
+	lastErr error
+}
+
+// refreshPodsTimeout bounds the CRI calls of the refreshes asked for
+// from outside the collection loop.
+const refreshPodsTimeout = 10 * time.Second
+
+// updatePods doesn't need the lock of the Notifier: the resolver swaps
+// in the new listing on its own.
+func (notif *Notifier) updatePods(ctx context.Context) error {
+	now := time.Now()
+	notif.pods.lock.Lock()
+	notif.pods.begin = now
+	notif.pods.lock.Unlock()
+
+	err := notif.pr.Update(ctx)
+
+	notif.pods.lock.Lock()
+	notif.pods.done = time.Now()
+	notif.pods.lastErr = err
+	notif.pods.lock.Unlock()
+	return err
+}
+
+func (notif *Notifier) healthWindow() time.Duration {
+	window := 3 * notif.tick
+	if window < minHealthWindow {
+		window = minHealthWindow
+	}
+	return window
+}
+
+// Health checks the progress of the collection loop, the sink and,
+// if RequirePods is set, the pod resolution.
+func (notif *Notifier) Health(now time.Time) Health {
+	h := Health{Live: true, Ready: true}
+	notReady := func(format string, args ...interface{}) {
+		h.Ready = false
+		h.Reasons = append(h.Reasons, fmt.Sprintf(format, args...))
+	}
+	window := notif.healthWindow()
+
+	stats := notif.Stats()
+	if stats.Started.IsZero() {
+		notReady("collection not started")
+	} else if stats.Ticks == 0 {
+		if now.Sub(stats.Started) > window {
+			h.Live = false
+			notReady("no tick completed since %v", stats.Started.Format(time.RFC3339))
+		} else {
+			notReady("no tick completed yet")
+		}
+	} else if now.Sub(stats.LastTick) > window {
+		h.Live = false
+		notReady("last tick completed at %v", stats.LastTick.Format(time.RFC3339))
+	}
+
+	sink := notif.sinkStatus()
+	if sink.LastError != "" {
+		notReady("sink failed: %s", sink.LastError)
+	}
+
+	if notif.RequirePods {
+		notif.pods.lock.Lock()
+		begin, done, err := notif.pods.begin, notif.pods.done, notif.pods.lastErr
+		notif.pods.lock.Unlock()
+		if notif.pr == nil {
+			notReady("pod resolution not enabled")
+		} else if begin.After(done) && now.Sub(begin) > window {
+			notReady("pod resolution stuck since %v", begin.Format(time.RFC3339))
+		} else if err != nil {
+			notReady("pod resolution failed: %v", err)
+		} else if done.IsZero() {
+			notReady("pod resolution not done yet")
+		}
+	}
+	return h
+}
@@ -0,0 +1,49 @@
+package procnotify
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestHealth(t *testing.T) {
+	notif := NewNotifier([]Config{{Name: "vdsm", Argv: []string{"vdsm"}}}, nil, "")
+	notif.Schedule(time.Minute)
+	start := time.Unix(1539000000, 0)
+
+	h := notif.Health(start)
+	if !h.Live || h.Ready {
+		t.Errorf("unexpected health before start: %+v", h)
+	}
+
+	notif.stats.start(start)
+	h = notif.Health(start.Add(time.Minute))
+	if !h.Live || h.Ready {
+		t.Errorf("unexpected health before the first tick: %+v", h)
+	}
+
+	notif.stats.tickDone(start.Add(time.Minute), time.Second, 0)
+	notif.flushDone(start.Add(time.Minute), 0, nil)
+	h = notif.Health(start.Add(2 * time.Minute))
+	if !h.Live || !h.Ready {
+		t.Errorf("unexpected health after a tick: %+v", h)
+	}
+
+	notif.flushDone(start.Add(2*time.Minute), 0, errors.New("connection refused"))
+	h = notif.Health(start.Add(2 * time.Minute))
+	if !h.Live || h.Ready || len(h.Reasons) != 1 {
+		t.Errorf("unexpected health with the sink down: %+v", h)
+	}
+
+	h = notif.Health(start.Add(time.Hour))
+	if h.Live || h.Ready {
+		t.Errorf("unexpected health with the loop stuck: %+v", h)
+	}
+
+	notif.flushDone(start.Add(2*time.Minute), 0, nil)
+	notif.RequirePods = true
+	h = notif.Health(start.Add(2 * time.Minute))
+	if !h.Live || h.Ready {
+		t.Errorf("unexpected health without pod resolution: %+v", h)
+	}
+}
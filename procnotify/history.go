@@ -0,0 +1,202 @@
+package procnotify
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultHistorySize is the number of samples kept per series:
+// one hour at the default 5s interval.
+const DefaultHistorySize = 720
+
+const historySaveInterval = time.Minute
+
+// Query selects the samples to get from the History.
+// Zero values match everything.
+type Query struct {
+	Target string
+	Pid    int32
+	// Metric matches either the full name (cpu-perc) or just its type (cpu)
+	Metric string
+	From   time.Time
+	To     time.Time
+}
+
+func (q Query) matches(s Sample) bool {
+	if q.Target != "" && q.Target != s.Target {
+		return false
+	}
+	if q.Pid != 0 && q.Pid != s.Pid {
+		return false
+	}
+	if q.Metric != "" && q.Metric != s.Name && !strings.HasPrefix(s.Name, q.Metric+"-") {
+		return false
+	}
+	if !q.From.IsZero() && s.Time.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && s.Time.After(q.To) {
+		return false
+	}
+	return true
+}
+
+// ring holds the most recent samples of a series.
+type ring struct {
+	items []Sample
+	next  int
+}
+
+func (r *ring) add(s Sample, size int) {
+	if len(r.items) < size {
+		r.items = append(r.items, s)
+		return
+	}
+	r.items[r.next] = s
+	r.next = (r.next + 1) % size
+}
+
+func (r *ring) last() Sample {
+	if r.next == 0 {
+		return r.items[len(r.items)-1]
+	}
+	return r.items[r.next-1]
+}
+
+// History keeps a bounded amount of recent samples per series
+// (identifier and name), optionally persisted on disk.
+type History struct {
+	// Path is the file the history is saved to, if not empty
+	Path     string
+	lock     sync.RWMutex
+	size     int
+	series   map[string]*ring
+	lastSave time.Time
+}
+
+func NewHistory(size int) *History {
+	if size <= 0 {
+		size = DefaultHistorySize
+	}
+	return &History{
+		size:   size,
+		series: make(map[string]*ring),
+	}
+}
+
+func (h *History) Add(items []Sample) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	for _, item := range items {
+		key := item.Ident + "/" + item.Name
+		r, ok := h.series[key]
+		if !ok {
+			r = &ring{}
+			h.series[key] = r
+		}
+		r.add(item, h.size)
+	}
+}
+
+// Prune forgets the series which were not updated for longer than
+// the time span their ring buffer would cover.
+func (h *History) Prune(now time.Time) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	for key, r := range h.series {
+		last := r.last()
+		span := time.Duration(last.Interval*h.size) * time.Second
+		if span > 0 && now.Sub(last.Time) > span {
+			delete(h.series, key)
+		}
+	}
+}
+
+// Query returns the matching samples, sorted by time.
+func (h *History) Query(q Query) []Sample {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	var res []Sample
+	for _, r := range h.series {
+		for _, item := range r.items {
+			if q.matches(item) {
+				res = append(res, item)
+			}
+		}
+	}
+	sortSamples(res)
+	return res
+}
+
+func sortSamples(items []Sample) {
+	sort.SliceStable(items, func(i, j int) bool {
+		if !items[i].Time.Equal(items[j].Time) {
+			return items[i].Time.Before(items[j].Time)
+		}
+		if items[i].Ident != items[j].Ident {
+			return items[i].Ident < items[j].Ident
+		}
+		return items[i].Name < items[j].Name
+	})
+}
+
+// Save writes the history to Path, replacing it atomically.
+func (h *History) Save() error {
+	if h.Path == "" {
+		return nil
+	}
+	data, err := json.Marshal(h.Query(Query{}))
+	if err != nil {
+		return err
+	}
+	tmp := h.Path + ".tmp"
+	err = ioutil.WriteFile(tmp, data, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, h.Path)
+}
+
+// Load reads back the history from Path. A missing file is not an error.
+func (h *History) Load() error {
+	if h.Path == "" {
+		return nil
+	}
+	items, err := ReadHistory(h.Path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	h.Add(items)
+	return nil
+}
+
+// ReadHistory reads the samples saved by History.Save.
+func ReadHistory(path string) ([]Sample, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var items []Sample
+	err = json.Unmarshal(data, &items)
+	return items, err
+}
+
+// record stores the samples of a tick, saving the history on disk
+// at most once every saveInterval.
+func (h *History) record(items []Sample, now time.Time, saveInterval time.Duration) error {
+	h.Add(items)
+	h.Prune(now)
+	if h.Path == "" || now.Sub(h.lastSave) < saveInterval {
+		return nil
+	}
+	h.lastSave = now
+	return h.Save()
+}
@@ -0,0 +1,79 @@
+package procnotify
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHistoryRing(t *testing.T) {
+	h := NewHistory(3)
+	start := time.Unix(1539000000, 0)
+	for idx := 0; idx < 5; idx++ {
+		h.Add([]Sample{
+			{Target: "vdsm", Pid: 42, Ident: "host/exec-vdsm-42", Name: "percent-cpu", Interval: 5, Time: start.Add(time.Duration(idx) * 5 * time.Second), Value: float64(idx)},
+			{Target: "vdsm", Pid: 42, Ident: "host/exec-vdsm-42", Name: "memory-resident", Interval: 5, Time: start.Add(time.Duration(idx) * 5 * time.Second), Value: 1024},
+		})
+	}
+
+	items := h.Query(Query{Metric: "percent"})
+	if len(items) != 3 {
+		t.Fatalf("unexpected samples: %v", items)
+	}
+	for idx, item := range items {
+		if item.Value != float64(idx+2) {
+			t.Errorf("mismatch at %d: %v", idx, item)
+		}
+	}
+
+	items = h.Query(Query{Pid: 42, From: start.Add(20 * time.Second)})
+	if len(items) != 2 {
+		t.Errorf("unexpected samples: %v", items)
+	}
+	if items := h.Query(Query{Target: "qemu"}); len(items) != 0 {
+		t.Errorf("unexpected samples: %v", items)
+	}
+
+	h.Prune(start.Add(30 * time.Second))
+	if items := h.Query(Query{}); len(items) != 6 {
+		t.Errorf("series pruned too early: %v", items)
+	}
+	h.Prune(start.Add(time.Hour))
+	if items := h.Query(Query{}); len(items) != 0 {
+		t.Errorf("stale series not pruned: %v", items)
+	}
+}
+
+func TestHistorySaveLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "procnotify")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	h := NewHistory(0)
+	h.Path = filepath.Join(dir, "history.json")
+	err = h.Load()
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	now := time.Unix(1539000000, 0).UTC()
+	h.Add([]Sample{{Target: "vdsm", Pid: 42, Ident: "host/exec-vdsm-42", Name: "percent-cpu", Interval: 5, Time: now, Value: 12.5}})
+	err = h.Save()
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	restored := NewHistory(0)
+	restored.Path = h.Path
+	err = restored.Load()
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	items := restored.Query(Query{})
+	if len(items) != 1 || items[0].Value != 12.5 || !items[0].Time.Equal(now) {
+		t.Errorf("mismatch: %v", items)
+	}
+}
@@ -0,0 +1,62 @@
+package procnotify
+
+import (
+	"fmt"
+	"time"
+)
+
+// inRange tells if the given instance count is within the limits the
+// target expects. Zero means no limit.
+func (t *Target) inRange(count int) bool {
+	if count < t.Min {
+		return false
+	}
+	if t.Max > 0 && count > t.Max {
+		return false
+	}
+	return true
+}
+
+func (t *Target) expected() string {
+	if t.Max > 0 {
+		return fmt.Sprintf("[%d, %d]", t.Min, t.Max)
+	}
+	return fmt.Sprintf("[%d, ...]", t.Min)
+}
+
+// checkInstances notifies when the instance count of the target goes
+// outside the expected range, and when it gets back into it.
+func (notif *Notifier) checkInstances(hostname string, t *Target, count int, now time.Time) bool {
+	up := t.inRange(count)
+	if up == !t.down {
+		return up
+	}
+	t.down = !up
+
+	n := Event{
+		Severity: SeverityOkay,
+		Time:     now,
+		Host:     hostname,
+		Target:   t.Name,
+		Metric:   "count-instances",
+		Message:  fmt.Sprintf("%d instance(s) running, expected %s", count, t.expected()),
+	}
+	if !up {
+		n.Severity = SeverityWarning
+		if count == 0 {
+			n.Severity = SeverityFailure
+		}
+	}
+	notif.notify(n)
+	return up
+}
+
+func (notif *Notifier) countInstances() map[*Target]int {
+	counts := make(map[*Target]int)
+	for _, proc := range notif.procs {
+		if proc.parent == 0 {
+			counts[proc.t]++
+		}
+	}
+	return counts
+}
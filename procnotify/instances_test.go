@@ -0,0 +1,56 @@
+package procnotify
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCheckInstances(t *testing.T) {
+	notif := NewNotifier([]Config{
+		{Name: "libvirtd", Argv: []string{"libvirtd"}, Min: 1, Max: 1},
+	}, nil, "")
+	target := notif.targets[0]
+	now := time.Unix(1539000000, 0)
+
+	type testcase struct {
+		count    int
+		up       bool
+		severity string
+	}
+	testcases := []testcase{
+		{count: 1, up: true},
+		{count: 0, up: false, severity: SeverityFailure},
+		{count: 0, up: false},
+		{count: 2, up: false},
+		{count: 1, up: true, severity: SeverityOkay},
+		{count: 1, up: true},
+	}
+	for idx, tcase := range testcases {
+		up := notif.checkInstances("host", target, tcase.count, now)
+		if up != tcase.up {
+			t.Errorf("#%d: unexpected up: %v", idx, up)
+		}
+		notes := notif.pendingNotifications()
+		if tcase.severity == "" && len(notes) > 0 {
+			t.Errorf("#%d: unexpected notifications: %v", idx, notes)
+		}
+		if tcase.severity != "" && (len(notes) != 1 || notes[0].Severity != tcase.severity) {
+			t.Errorf("#%d: unexpected notifications: %v", idx, notes)
+		}
+	}
+}
+
+func TestNotificationString(t *testing.T) {
+	n := Event{
+		Severity: SeverityFailure,
+		Time:     time.Unix(1539000000, 0),
+		Host:     "node0",
+		Target:   "libvirtd",
+		Metric:   "count-instances",
+		Message:  "0 instance(s) running, expected [1, 1]",
+	}
+	expected := `PUTNOTIF severity=failure time=1539000000.000 host=node0 plugin=exec plugin_instance=libvirtd type=count type_instance=instances message="0 instance(s) running, expected [1, 1]"`
+	if n.String() != expected {
+		t.Errorf("mismatch:\ngot      %s\nexpected %s", n.String(), expected)
+	}
+}
@@ -0,0 +1,196 @@
+package procnotify
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	DefaultLeakMetric = "memory-resident"
+	DefaultLeakMinFit = 0.8
+)
+
+// LeakDetection configures the analysis of the memory trend of the
+// processes of a target.
+type LeakDetection struct {
+	// Metric to analyze, default is memory-resident
+	Metric string `json:"metric"`
+	// Window of the samples to analyze
+	Window Duration `json:"window"`
+	// Slope is the growth, in metric units per hour, over which the
+	// process is suspected of leaking
+	Slope float64 `json:"slope"`
+	// MinFit is the minimum coefficient of determination (R^2) of the
+	// linear regression needed to trust the trend. Default is 0.8.
+	MinFit float64 `json:"min_fit"`
+}
+
+func (ld LeakDetection) Validate() error {
+	if ld.Window.Duration <= 0 {
+		return fmt.Errorf("leak detection: missing window")
+	}
+	if ld.Slope <= 0 {
+		return fmt.Errorf("leak detection: invalid slope: %v", ld.Slope)
+	}
+	if ld.MinFit < 0 || ld.MinFit > 1 {
+		return fmt.Errorf("leak detection: invalid min fit: %v", ld.MinFit)
+	}
+	return nil
+}
+
+type point struct {
+	at    time.Time
+	value float64
+}
+
+type leakState struct {
+	target    string
+	metric    string
+	points    []point
+	suspected bool
+	lastSeen  time.Time
+}
+
+// trend fits the points with a linear regression, and returns the slope,
+// in units per second, and the coefficient of determination.
+func trend(points []point) (float64, float64) {
+	if len(points) < 2 {
+		return 0, 0
+	}
+	n := float64(len(points))
+	var sx, sy, sxx, sxy, syy float64
+	for _, p := range points {
+		x := p.at.Sub(points[0].at).Seconds()
+		y := p.value
+		sx += x
+		sy += y
+		sxx += x * x
+		sxy += x * y
+		syy += y * y
+	}
+	den := n*sxx - sx*sx
+	if den == 0 {
+		return 0, 0
+	}
+	slope := (n*sxy - sx*sy) / den
+	vary := n*syy - sy*sy
+	if vary == 0 {
+		// flat line: perfectly fit, no growth
+		return slope, 1
+	}
+	r := (n*sxy - sx*sy) / math.Sqrt(den*vary)
+	return slope, r * r
+}
+
+// leakScore is in [0, 1]: how much the growth approaches the configured
+// slope, weighted by how well the samples fit a line.
+func leakScore(slope, fit, threshold float64) float64 {
+	if slope <= 0 {
+		return 0
+	}
+	return math.Min(1, slope/threshold) * fit
+}
+
+// analyzeLeaks feeds the memory samples just collected to the rolling
+// windows of their series, and returns the samples reporting the trends.
+// Notifies the series starting and stopping to be leak suspects.
+func (notif *Notifier) analyzeLeaks(hostname string, due map[*Target]bool, items []Sample, now time.Time) []Sample {
+	targets := make(map[string]*Target)
+	for target := range due {
+		if target.LeakDetection != nil {
+			targets[target.Name] = target
+		}
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+	if notif.leakStates == nil {
+		notif.leakStates = make(map[string]*leakState)
+	}
+
+	var trends []Sample
+	for _, item := range items {
+		target, ok := targets[item.Target]
+		if !ok {
+			continue
+		}
+		ld := *target.LeakDetection
+		if ld.Metric == "" {
+			ld.Metric = DefaultLeakMetric
+		}
+		if ld.MinFit == 0 {
+			ld.MinFit = DefaultLeakMinFit
+		}
+		if item.Name != ld.Metric {
+			continue
+		}
+
+		st, ok := notif.leakStates[item.Ident]
+		if !ok {
+			st = &leakState{target: target.Name, metric: ld.Metric}
+			notif.leakStates[item.Ident] = st
+		}
+		st.lastSeen = now
+		st.points = append(st.points, point{at: item.Time, value: item.Value})
+		for len(st.points) > 0 && item.Time.Sub(st.points[0].at) > ld.Window.Duration {
+			st.points = st.points[1:]
+		}
+
+		slope, fit := trend(st.points)
+		slopePerHour := slope * time.Hour.Seconds()
+		score := leakScore(slopePerHour, fit, ld.Slope)
+		s := &samples{
+			target:   item.Target,
+			pid:      item.Pid,
+			parent:   item.Parent,
+			ident:    item.Ident,
+			interval: item.Interval,
+			time:     item.Time,
+		}
+		s.add("gauge-leak_slope", slopePerHour)
+		s.add("gauge-leak_score", score)
+		trends = append(trends, s.items...)
+
+		// don't judge before having seen most of the window
+		full := item.Time.Sub(st.points[0].at) >= ld.Window.Duration*9/10
+		suspected := full && fit >= ld.MinFit && slopePerHour >= ld.Slope
+		if suspected == st.suspected {
+			continue
+		}
+		if !suspected && !full {
+			continue
+		}
+		st.suspected = suspected
+		n := Event{
+			Severity: SeverityWarning,
+			Time:     now,
+			Host:     hostname,
+			Target:   target.Name,
+			Instance: pluginInstance(item.Ident),
+			Metric:   "gauge-leak_score",
+			Message: fmt.Sprintf("%s growing %.1f/h over the last %v (fit %.2f): suspected leak",
+				ld.Metric, slopePerHour, ld.Window, fit),
+		}
+		if !suspected {
+			n.Severity = SeverityOkay
+			n.Message = fmt.Sprintf("%s growing %.1f/h over the last %v (fit %.2f): no longer suspected",
+				ld.Metric, slopePerHour, ld.Window, fit)
+		}
+		notif.notify(n)
+	}
+
+	// the points of a process silent for an hour are too old to resume
+	// its trend: drop them, and clear the suspicion
+	for ident, st := range notif.leakStates {
+		if now.Sub(st.lastSeen) <= time.Hour {
+			continue
+		}
+		if st.suspected {
+			notif.notifyGone(hostname, now, st.target, ident, "gauge-leak_score",
+				fmt.Sprintf("%s no longer reported: no longer suspected", st.metric))
+		}
+		delete(notif.leakStates, ident)
+	}
+	return trends
+}
@@ -0,0 +1,129 @@
+package procnotify
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestTrend(t *testing.T) {
+	start := time.Unix(1539000000, 0)
+	var points []point
+	for idx := 0; idx < 10; idx++ {
+		points = append(points, point{at: start.Add(time.Duration(idx) * time.Minute), value: 1000 + 60*float64(idx)})
+	}
+	slope, fit := trend(points)
+	if math.Abs(slope-1) > 1e-9 {
+		t.Errorf("unexpected slope: %v", slope)
+	}
+	if math.Abs(fit-1) > 1e-9 {
+		t.Errorf("unexpected fit: %v", fit)
+	}
+
+	flat := []point{{at: start, value: 5}, {at: start.Add(time.Minute), value: 5}}
+	if slope, _ := trend(flat); slope != 0 {
+		t.Errorf("unexpected slope: %v", slope)
+	}
+}
+
+func TestAnalyzeLeaks(t *testing.T) {
+	notif := NewNotifier([]Config{
+		{
+			Name: "vdsm",
+			Argv: []string{"vdsm"},
+			LeakDetection: &LeakDetection{
+				Window: Duration{time.Hour},
+				Slope:  1024,
+			},
+		},
+	}, nil, "")
+	notif.Schedule(time.Minute)
+	due := map[*Target]bool{notif.targets[0]: true}
+	start := time.Unix(1539000000, 0)
+
+	feed := func(idx int, value float64) ([]Sample, []Event) {
+		now := start.Add(time.Duration(idx) * time.Minute)
+		items := []Sample{
+			{Target: "vdsm", Pid: 42, Ident: "host/exec-vdsm-42", Name: "memory-resident", Time: now, Value: value},
+		}
+		trends := notif.analyzeLeaks("host", due, items, now)
+		return trends, notif.pendingNotifications()
+	}
+
+	// growing 2 MiB/h: suspected only once most of the window is seen
+	value := 100000.0
+	for idx := 0; idx <= 60; idx++ {
+		trends, notes := feed(idx, value)
+		if len(trends) != 2 {
+			t.Fatalf("unexpected trends: %v", trends)
+		}
+		if idx < 54 && len(notes) > 0 {
+			t.Errorf("#%d: early notification: %v", idx, notes)
+		}
+		if idx == 54 && (len(notes) != 1 || notes[0].Severity != SeverityWarning) {
+			t.Errorf("#%d: missing notification: %v", idx, notes)
+		}
+		if idx == 60 && math.Abs(trends[1].Value-1) > 1e-6 {
+			t.Errorf("unexpected score: %v", trends[1].Value)
+		}
+		value += 2048.0 / 60
+	}
+
+	// growth stops: no longer suspected once the window forgets the growth
+	resolved := false
+	for idx := 61; idx <= 180; idx++ {
+		_, notes := feed(idx, value)
+		for _, note := range notes {
+			if note.Severity == SeverityOkay {
+				resolved = true
+			}
+		}
+	}
+	if !resolved {
+		t.Errorf("leak suspect not resolved")
+	}
+}
+
+func TestAnalyzeLeaksGone(t *testing.T) {
+	notif := NewNotifier([]Config{
+		{
+			Name: "vdsm",
+			Argv: []string{"vdsm"},
+			LeakDetection: &LeakDetection{
+				Window: Duration{time.Hour},
+				Slope:  1024,
+			},
+		},
+	}, nil, "")
+	notif.Schedule(time.Minute)
+	due := map[*Target]bool{notif.targets[0]: true}
+	start := time.Unix(1539000000, 0)
+
+	value := 100000.0
+	for idx := 0; idx <= 60; idx++ {
+		now := start.Add(time.Duration(idx) * time.Minute)
+		items := []Sample{
+			{Target: "vdsm", Pid: 42, Ident: "host/exec-vdsm-42", Name: "memory-resident", Time: now, Value: value},
+		}
+		notif.analyzeLeaks("host", due, items, now)
+		value += 2048.0 / 60
+	}
+	notes := notif.pendingNotifications()
+	if len(notes) != 1 || notes[0].Severity != SeverityWarning {
+		t.Fatalf("missing notification: %v", notes)
+	}
+
+	// the process is gone: the suspect must be resolved when forgotten
+	notif.analyzeLeaks("host", due, nil, start.Add(90*time.Minute))
+	if notes := notif.pendingNotifications(); len(notes) != 0 {
+		t.Errorf("early notification: %v", notes)
+	}
+	notif.analyzeLeaks("host", due, nil, start.Add(3*time.Hour))
+	notes = notif.pendingNotifications()
+	if len(notes) != 1 || notes[0].Severity != SeverityOkay || notes[0].Instance != "vdsm-42" {
+		t.Errorf("mismatch: %v", notes)
+	}
+	if len(notif.leakStates) != 0 {
+		t.Errorf("unexpected states: %v", notif.leakStates)
+	}
+}
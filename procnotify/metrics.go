@@ -0,0 +1,202 @@
+package procnotify
+
+import (
+	"github.com/fromanirh/procwatch/cgroups"
+	"github.com/fromanirh/procwatch/procfs"
+
+	"fmt"
+	"os"
+)
+
+const (
+	MetricsCPU       = "cpu"
+	MetricsMemory    = "memory"
+	MetricsIO        = "io"
+	MetricsFDs       = "fds"
+	MetricsThreads   = "threads"
+	MetricsSmaps     = "smaps"
+	MetricsFaults    = "faults"
+	MetricsSchedstat = "schedstat"
+	MetricsPressure  = "pressure"
+	MetricsContainer = "container"
+	MetricsUptime    = "uptime"
+)
+
+// DefaultMetrics are collected for targets which don't list their own.
+var DefaultMetrics = []string{MetricsCPU, MetricsMemory}
+
+type collectFunc func(notif *Notifier, proc Proc, s *samples) error
+
+var collectors = map[string]collectFunc{
+	MetricsCPU:       collectCPU,
+	MetricsMemory:    collectMemory,
+	MetricsIO:        collectIO,
+	MetricsFDs:       collectFDs,
+	MetricsThreads:   collectThreads,
+	MetricsSmaps:     collectSmaps,
+	MetricsFaults:    collectFaults,
+	MetricsSchedstat: collectSchedstat,
+	MetricsPressure:  collectPressure,
+	MetricsUptime:    collectUptime,
+}
+
+func collectCPU(notif *Notifier, proc Proc, s *samples) error {
+	st, err := procfs.ReadStat(proc.p.Pid)
+	if err != nil {
+		return err
+	}
+	total := float64(st.UTime+st.STime) / procfs.UserHZ
+	// the first sample of a process has nothing to be compared to
+	cpu_perc, ok := notif.cpu.update(proc.p.Pid, int64(st.StartTime), total, s.time)
+	if ok {
+		s.add("cpu-perc", cpu_perc)
+		s.add("percent-cpu", cpu_perc)
+		s.add("percent-cpu_normalized", cpu_perc/float64(notif.cpu.ncpu))
+	}
+
+	// cumulative times, in clock ticks: "cpu" is a DERIVE type, so their rate
+	// is a percentage of one CPU, like the collectd cpu plugin does.
+	s.add("cpu-user", float64(st.UTime))
+	s.add("cpu-system", float64(st.STime))
+	// only where the kernel reports them: fields 42 and 43 in proc(5)
+	if st.Fields >= 42 {
+		s.add("cpu-iowait", float64(st.BlkioTicks))
+	}
+	if st.Fields >= 43 {
+		s.add("cpu-guest", float64(st.GuestTime))
+	}
+	return nil
+}
+
+func collectMemory(notif *Notifier, proc Proc, s *samples) error {
+	mem_info, err := proc.p.MemoryInfo()
+	if err != nil {
+		return err
+	}
+	s.add("memory-virtual", float64(mem_info.VMS/1024))
+	s.add("memory-resident", float64(mem_info.RSS/1024))
+	return nil
+}
+
+func collectIO(notif *Notifier, proc Proc, s *samples) error {
+	io_counters, err := proc.p.IOCounters()
+	if err != nil {
+		return err
+	}
+	s.add("total_bytes-read", float64(io_counters.ReadBytes))
+	s.add("total_bytes-write", float64(io_counters.WriteBytes))
+	s.add("total_operations-read", float64(io_counters.ReadCount))
+	s.add("total_operations-write", float64(io_counters.WriteCount))
+	return nil
+}
+
+func collectFDs(notif *Notifier, proc Proc, s *samples) error {
+	num_fds, err := procfs.CountFDs(proc.p.Pid)
+	if err != nil {
+		return err
+	}
+	s.add("file_handles-open", float64(num_fds))
+
+	limits, err := procfs.ReadLimits(proc.p.Pid)
+	if err != nil {
+		return err
+	}
+	limit, ok := limits[procfs.LimitOpenFiles]
+	if ok && limit.Soft != procfs.Unlimited && limit.Soft > 0 {
+		s.add("file_handles-limit", float64(limit.Soft))
+		s.add("percent-file_handles", 100*float64(num_fds)/float64(limit.Soft))
+	}
+	return nil
+}
+
+func collectThreads(notif *Notifier, proc Proc, s *samples) error {
+	status, err := procfs.ReadStatus(proc.p.Pid)
+	if err != nil {
+		return err
+	}
+	s.add("threads", float64(status.Threads))
+	s.add("contextswitch-voluntary", float64(status.VoluntaryCtxtSwitches))
+	s.add("contextswitch-involuntary", float64(status.NonvoluntaryCtxtSwitches))
+	return nil
+}
+
+func collectFaults(notif *Notifier, proc Proc, s *samples) error {
+	st, err := procfs.ReadStat(proc.p.Pid)
+	if err != nil {
+		return err
+	}
+	s.add("derive-page_faults_minor", float64(st.MinFlt))
+	s.add("derive-page_faults_major", float64(st.MajFlt))
+	return nil
+}
+
+func collectSmaps(notif *Notifier, proc Proc, s *samples) error {
+	maps, err := proc.p.MemoryMaps(true)
+	if err != nil {
+		return err
+	}
+	var pss, swap, shared, private uint64
+	for _, m := range *maps {
+		pss += m.Pss
+		swap += m.Swap
+		shared += m.SharedClean + m.SharedDirty
+		private += m.PrivateClean + m.PrivateDirty
+	}
+	// smaps already reports kB
+	s.add("memory-proportional", float64(pss))
+	s.add("memory-swap", float64(swap))
+	s.add("memory-shared", float64(shared))
+	s.add("memory-private", float64(private))
+	return nil
+}
+
+func collectSchedstat(notif *Notifier, proc Proc, s *samples) error {
+	ss, err := procfs.ReadSchedstat(proc.p.Pid)
+	if err != nil {
+		return err
+	}
+	s.add("derive-schedstat_run_ns", float64(ss.RunTime))
+	s.add("derive-schedstat_wait_ns", float64(ss.WaitTime))
+	s.add("derive-schedstat_timeslices", float64(ss.Timeslices))
+	return nil
+}
+
+var pressureResources = []string{"cpu", "memory", "io"}
+
+func addPressure(s *samples, prefix string, ps cgroups.PressureStat) {
+	s.add(fmt.Sprintf("percent-%s_avg10", prefix), ps.Avg10)
+	s.add(fmt.Sprintf("percent-%s_avg60", prefix), ps.Avg60)
+	s.add(fmt.Sprintf("percent-%s_avg300", prefix), ps.Avg300)
+	s.add(fmt.Sprintf("derive-%s_total_us", prefix), float64(ps.Total))
+}
+
+// collectPressure reports the PSI of the cgroup the process lives in, if
+// any. Processes in the root cgroup, or on hosts without cgroup v2 or PSI
+// support, silently report nothing.
+func collectPressure(notif *Notifier, proc Proc, s *samples) error {
+	entries, err := cgroups.ReadProcCGroups(proc.p.Pid)
+	if err != nil {
+		return err
+	}
+	dir, err := cgroups.UnifiedDir(entries)
+	if err == cgroups.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, resource := range pressureResources {
+		pr, err := cgroups.ReadPressure(dir, resource)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		addPressure(s, fmt.Sprintf("pressure_%s_some", resource), pr.Some)
+		if pr.Full != nil {
+			addPressure(s, fmt.Sprintf("pressure_%s_full", resource), *pr.Full)
+		}
+	}
+	return nil
+}
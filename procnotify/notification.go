@@ -0,0 +1,112 @@
+package procnotify
+
+import (
+	"github.com/fromanirh/procwatch/proclog"
+
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Notification severities, as collectd names them
+const (
+	SeverityOkay    = "okay"
+	SeverityWarning = "warning"
+	SeverityFailure = "failure"
+)
+
+const webhookTimeout = 5 * time.Second
+
+// Event is a notification raised by the collection, like a target
+// going down or a metric crossing the threshold of a rule.
+type Event struct {
+	Severity string    `json:"severity"`
+	Time     time.Time `json:"time"`
+	Host     string    `json:"host"`
+	Target   string    `json:"target"`
+	Instance string    `json:"instance,omitempty"`
+	Metric   string    `json:"metric"`
+	Message  string    `json:"message"`
+}
+
+// String formats the notification as collectd PUTNOTIF command.
+func (n Event) String() string {
+	typ := n.Metric
+	typeInstance := ""
+	if idx := strings.Index(n.Metric, "-"); idx >= 0 {
+		typ = n.Metric[:idx]
+		typeInstance = n.Metric[idx+1:]
+	}
+	instance := n.Instance
+	if instance == "" {
+		instance = n.Target
+	}
+	opts := []string{
+		"severity=" + n.Severity,
+		"time=" + formatTime(n.Time),
+		"host=" + n.Host,
+		"plugin=exec",
+		"plugin_instance=" + instance,
+		"type=" + typ,
+	}
+	if typeInstance != "" {
+		opts = append(opts, "type_instance="+typeInstance)
+	}
+	// message must be the last option
+	opts = append(opts, fmt.Sprintf("message=%q", n.Message))
+	return "PUTNOTIF " + strings.Join(opts, " ")
+}
+
+// notify logs the notification, queues it to be sent to the sink with the
+// next samples and, if configured, posts it to the webhook.
+func (notif *Notifier) notify(n Event) {
+	instance := n.Instance
+	if instance == "" {
+		instance = n.Target
+	}
+	level := proclog.LevelInfo
+	switch n.Severity {
+	case SeverityWarning:
+		level = proclog.LevelWarning
+	case SeverityFailure:
+		level = proclog.LevelError
+	}
+	logger.Log(level, n.Message, "instance", instance, "metric", n.Metric, "severity", n.Severity)
+
+	notif.notesLock.Lock()
+	notif.notes = append(notif.notes, n)
+	notif.notesLock.Unlock()
+
+	if notif.Webhook != "" {
+		go notif.postWebhook(n)
+	}
+}
+
+func (notif *Notifier) pendingNotifications() []Event {
+	notif.notesLock.Lock()
+	defer notif.notesLock.Unlock()
+	notes := notif.notes
+	notif.notes = nil
+	return notes
+}
+
+func (notif *Notifier) postWebhook(n Event) {
+	data, err := json.Marshal(n)
+	if err != nil {
+		logger.Error("cannot encode the notification", "error", err)
+		return
+	}
+	client := http.Client{Timeout: webhookTimeout}
+	resp, err := client.Post(notif.Webhook, "application/json", bytes.NewReader(data))
+	if err != nil {
+		throttled.Warning("cannot post the notification", "error", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		throttled.Warning("cannot post the notification", "status", resp.Status)
+	}
+}
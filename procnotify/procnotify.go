@@ -3,23 +3,62 @@ package procnotify
 import (
 	"github.com/fromanirh/procwatch/podfind"
 	"github.com/fromanirh/procwatch/procfind"
+	"github.com/fromanirh/procwatch/procfs"
+	"github.com/fromanirh/procwatch/proclog"
 	"github.com/shirou/gopsutil/process"
 
+	"context"
+	"errors"
 	"fmt"
 	"io"
-	"log"
-	"math"
-	"net"
-	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 )
 
+var (
+	ErrNoPodResolver = errors.New("pod resolution not enabled")
+	// ErrStalePids is returned when the tracked processes are gone
+	// or were replaced, and rescanning is not allowed
+	ErrStalePids = errors.New("stale pid(s)")
+)
+
+// logLimitInterval is the least time between two occurrences
+// of the messages which would repeat at every tick.
+const logLimitInterval = time.Minute
+
+var (
+	logger    = proclog.New("procnotify")
+	throttled = logger.Limit(logLimitInterval)
+)
+
 type Config struct {
 	Name       string   `json:"name"`
 	Argv       []string `json:"argv"`
 	StableName bool     `json:"stable_name"`
+	Interval   Duration `json:"interval"`
+	Metrics    []string `json:"metrics"`
+	// ThreadBreakdown enables the per-thread reporting, see ThreadBreakdown*
+	ThreadBreakdown string `json:"thread_breakdown"`
+	// Aggregate enables the per-target rollups across all the processes
+	Aggregate bool `json:"aggregate"`
+	// AggregateOnly reports only the rollups, not the single processes
+	AggregateOnly bool `json:"aggregate_only"`
+	// IncludeChildren tracks the children of the matched processes
+	IncludeChildren bool `json:"include_children"`
+	// IncludeDescendants tracks all the descendants of the matched processes
+	IncludeDescendants bool `json:"include_descendants"`
+	// SumChildren adds the usage of the tracked children or descendants
+	// to the one of the matched process, instead of reporting them apart
+	SumChildren bool `json:"sum_children"`
+	// Min and Max are the expected number of instances. Zero means no limit.
+	Min int `json:"min"`
+	Max int `json:"max"`
+	// Rules are the thresholds to notify about
+	Rules []Rule `json:"rules"`
+	// LeakDetection enables the analysis of the memory trend
+	LeakDetection *LeakDetection `json:"leak_detection"`
 }
 
 type TargetConfigs struct {
@@ -28,25 +67,73 @@ type TargetConfigs struct {
 
 type Target struct {
 	Config
-	Pids []procfind.Pid
+	Pids        []procfind.Pid
+	interval    time.Duration
+	next        time.Time
+	known       map[int32]uint64
+	pendingGone int
+	restarts    uint64
+	down        bool
 }
 
 func (t *Target) AddPid(p procfind.Pid) {
-	log.Printf("new PID: %v -> %v", t.Name, p)
 	t.Pids = append(t.Pids, p)
 }
 
 type Proc struct {
 	t *Target
 	p *process.Process
+	// parent is the matched process this one descends from, if any
+	parent int32
+	comm   string
 }
 
 type Notifier struct {
-	Debug    bool
-	targets  []*Target
-	procs    map[int32]Proc
-	pr       *podfind.PodResolver
-	sinkPath string
+	Workers int
+	// Deadline bounds the collection of a tick, which is by default
+	// the tick itself; negative means no bound
+	Deadline time.Duration
+	// Webhook is the URL notifications are POSTed to, if not empty
+	Webhook string
+	// History keeps the recent samples, if not nil
+	History *History
+	// RequirePods makes the pod resolution part of the readiness
+	RequirePods bool
+	// SelfMetrics enables the reporting of procwatch's own metrics
+	SelfMetrics bool
+	// Clock returns the time the samples are taken at, if not nil,
+	// instead of the current time
+	Clock func() time.Time
+	// Output is where the output goes, if not nil, instead of the sink
+	Output io.Writer
+	// Queue retains the output while the sink is unavailable, if not nil
+	Queue      *Queue
+	targets    []*Target
+	procs      map[int32]Proc
+	pr         *podfind.PodResolver
+	sinkPath   string
+	tick       time.Duration
+	stats      statsKeeper
+	cpu        *cpuTracker
+	btime      int64
+	notes      []Event
+	notesLock  sync.Mutex
+	ruleStates map[ruleKey]*ruleState
+	leakStates map[string]*leakState
+	// lock serializes the collection and the requests coming from outside
+	lock      sync.Mutex
+	lastScan  time.Time
+	scanStats procfind.ScanStats
+	last      map[int32][]Sample
+	sink      sinkState
+	pods      podState
+}
+
+func (notif *Notifier) now() time.Time {
+	if notif.Clock != nil {
+		return notif.Clock()
+	}
+	return time.Now()
 }
 
 func (notif *Notifier) MatchArgv(argv []string) (procfind.Entry, bool) {
@@ -66,6 +153,7 @@ func NewNotifier(targets []Config, pr *podfind.PodResolver, sinkPath string) *No
 	notif := Notifier{
 		pr:       pr,
 		sinkPath: sinkPath,
+		cpu:      newCPUTracker(),
 	}
 	for _, target := range targets {
 		t := &Target{
@@ -74,6 +162,9 @@ func NewNotifier(targets []Config, pr *podfind.PodResolver, sinkPath string) *No
 		if target.Name == "" {
 			t.Name = filepath.Base(target.Argv[0])
 		}
+		if len(target.Metrics) == 0 {
+			t.Metrics = DefaultMetrics
+		}
 		notif.targets = append(notif.targets, t)
 	}
 	return &notif
@@ -81,29 +172,52 @@ func NewNotifier(targets []Config, pr *podfind.PodResolver, sinkPath string) *No
 
 func (notif *Notifier) Dump(w io.Writer) error {
 	for _, target := range notif.targets {
-		fmt.Fprintf(w, "- %s [%s] stablename=%v\n",
-			target.Name, strings.Join(target.Argv, " "), target.StableName)
+		fmt.Fprintf(w, "- %s [%s] stablename=%v interval=%v metrics=%s\n",
+			target.Name, strings.Join(target.Argv, " "), target.StableName,
+			target.Interval, strings.Join(target.Metrics, ","))
 	}
 	return nil
 }
 
 func (notif *Notifier) Scan() error {
+	var err error
+	if notif.btime == 0 {
+		notif.btime, err = procfs.BootTime()
+		if err != nil {
+			return err
+		}
+	}
+
+	prev := notif.procs
 	notif.procs = make(map[int32]Proc)
-	found, err := procfind.ScanEntries(notif)
+	for _, target := range notif.targets {
+		target.Pids = nil
+	}
+	notif.scanStats, err = procfind.Scan(notif)
 	if err != nil {
 		return err
 	}
-	log.Printf("Scanned /proc and found %d pid(s)", found)
+	notif.lastScan = time.Now()
+	notif.trackRestarts()
 	for _, target := range notif.targets {
 		for _, pid := range target.Pids {
 			proc, err := process.NewProcess(int32(pid))
 			if err != nil {
-				log.Printf("cannot find process %v: %v", pid, err)
+				logger.Warning("cannot find the process", "target", target.Name, "pid", pid, "error", err)
 				continue
 			}
+			// rescans find the same processes again and again
+			if _, ok := prev[int32(pid)]; !ok {
+				logger.Info("new PID", "target", target.Name, "pid", pid)
+			}
 			notif.procs[int32(pid)] = Proc{p: proc, t: target}
 		}
 	}
+	err = notif.trackDescendants()
+	if err != nil {
+		throttled.Warning("cannot track the descendants", "error", err)
+	}
+	notif.cpu.prune(notif.procs)
 	return nil
 }
 
@@ -116,6 +230,10 @@ func (notif *Notifier) HasTargets() bool {
 
 func (notif *Notifier) IsCurrent() bool {
 	for pid, proc := range notif.procs {
+		// descendants come and go, and are refreshed at each update
+		if proc.parent != 0 {
+			continue
+		}
 		if !procfind.Match(proc.t.Argv, procfind.Pid(pid)) {
 			return false
 		}
@@ -123,146 +241,220 @@ func (notif *Notifier) IsCurrent() bool {
 	return true
 }
 
-func round(val float64, roundOn float64, places int) float64 {
-	var round float64
-	pow := math.Pow(10, float64(places))
-	digit := pow * val
-	_, div := math.Modf(digit)
-	if div >= roundOn {
-		round = math.Ceil(digit)
-	} else {
-		round = math.Floor(digit)
-	}
-	return round / pow
-}
-
-func (notif *Notifier) collectd(proc Proc, hostname string, interval int) error {
+// collect collects the metrics of the process, giving up between the
+// metric groups once the context expires.
+func (notif *Notifier) collect(ctx context.Context, proc Proc, hostname string) ([]Sample, error) {
 	var err error
 	var ident string
 
-	var sink io.Writer = os.Stdout
-	if notif.sinkPath != "" {
-		sock, err := net.Dial("unix", notif.sinkPath)
-		if err != nil {
-			return err
-		}
-		defer sock.Close()
-		sink = sock
-	}
-
-	if !proc.t.StableName {
+	if proc.parent != 0 {
+		ident = fmt.Sprintf("%s/exec-%s-%s_%d", hostname, proc.t.Name, proc.comm, proc.p.Pid)
+	} else if !proc.t.StableName {
 		if notif.pr != nil {
 			podName, err := notif.pr.FindPodByPID(proc.p.Pid)
 			if err == nil {
-				ident = fmt.Sprintf("PUTVAL %s/exec-%s-%s", hostname, proc.t.Name, podName)
+				ident = fmt.Sprintf("%s/exec-%s-%s", hostname, proc.t.Name, podName)
 			}
 		}
 		if ident == "" {
-			ident = fmt.Sprintf("PUTVAL %s/exec-%s-%d", hostname, proc.t.Name, proc.p.Pid)
+			ident = fmt.Sprintf("%s/exec-%s-%d", hostname, proc.t.Name, proc.p.Pid)
 		}
 	} else {
-		ident = fmt.Sprintf("PUTVAL %s/exec-%s", hostname, proc.t.Name)
-		fmt.Fprintf(sink, "%s/objects interval=%d N:%d\n", ident, interval, proc.p.Pid)
+		ident = fmt.Sprintf("%s/exec-%s", hostname, proc.t.Name)
 	}
 
-	cpu_perc, err := proc.p.Percent(0)
-	if err != nil {
-		return err
+	s := &samples{
+		target:   proc.t.Name,
+		pid:      proc.p.Pid,
+		parent:   proc.parent,
+		ident:    ident,
+		interval: int(proc.t.interval.Seconds()),
+		time:     notif.now(),
+	}
+	if proc.t.StableName && proc.parent == 0 {
+		s.add("objects", float64(proc.p.Pid))
 	}
-	fmt.Fprintf(sink, "%s/cpu-perc interval=%d N:%d\n", ident, interval, int(round(cpu_perc, 0.5, 0)))
-	fmt.Fprintf(sink, "%s/percent-cpu interval=%d N:%d\n", ident, interval, int(round(cpu_perc, 0.5, 0)))
 
-	cpu_times, err := proc.p.Times()
-	if err != nil {
-		return err
+	for _, group := range proc.t.Metrics {
+		collect, ok := collectors[group]
+		if !ok {
+			continue
+		}
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+		err = collect(notif, proc, s)
+		if err != nil {
+			return s.items, err
+		}
 	}
-	fmt.Fprintf(sink, "%s/cpu-user interval=%d N:%d\n", ident, interval, int(round(cpu_times.User, 0.5, 0)))
-	fmt.Fprintf(sink, "%s/cpu-system interval=%d N:%d\n", ident, interval, int(round(cpu_times.System, 0.5, 0)))
 
-	mem_info, err := proc.p.MemoryInfo()
-	if err != nil {
-		return err
+	if proc.t.ThreadBreakdown != "" {
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+		err = collectThreadBreakdown(notif, proc, s)
+		if err != nil {
+			return s.items, err
+		}
 	}
-	fmt.Fprintf(sink, "%s/memory-virtual interval=%d N:%d\n", ident, interval, mem_info.VMS/1024)
-	fmt.Fprintf(sink, "%s/memory-resident interval=%d N:%d\n", ident, interval, mem_info.RSS/1024)
 
-	return nil
+	return s.items, nil
 }
 
-func (notif *Notifier) Update(hostname string, interval int) {
+// Update collects the targets due at the given time, and sends
+// the output to the sink.
+func (notif *Notifier) Update(hostname string, now time.Time) {
+	notif.emit(notif.collectBatch(context.Background(), hostname, now))
+}
+
+// collectBatch collects the targets due at the given time, and runs
+// the analyses over the samples.
+func (notif *Notifier) collectBatch(parent context.Context, hostname string, now time.Time) Batch {
 	var err error
+	due := notif.dueTargets(now)
+	var procs []Proc
 	for _, proc := range notif.procs {
-		err = notif.collectd(proc, hostname, interval)
+		if due[proc.t] {
+			procs = append(procs, proc)
+		}
+	}
+
+	ctx, cancel := notif.collectContext(parent, now)
+	defer cancel()
+	begin := time.Now()
+	items, missed := notif.collectAll(ctx, hostname, procs)
+	if missed > 0 {
+		throttled.Warning("deadline exceeded", "missed", missed, "processes", len(procs))
+	}
+	containers, err := notif.containerSamples(ctx, hostname, procs)
+	if err != nil {
+		throttled.Warning("deadline exceeded collecting the containers", "error", err)
+	}
+	// the workers complete in random order
+	sortSamples(items)
+	items = notif.sumDescendants(items)
+	items = notif.aggregate(hostname, due, items)
+	items = append(items, containers...)
+	items = append(items, notif.targetSamples(hostname, due)...)
+	items = append(items, notif.analyzeLeaks(hostname, due, items, now)...)
+	if notif.SelfMetrics {
+		items = append(items, notif.selfSamples(hostname, now)...)
+	}
+	notif.evaluateRules(hostname, due, items, now)
+
+	if notif.History != nil {
+		err = notif.History.record(items, now, historySaveInterval)
 		if err != nil {
-			log.Printf("Update failed: %s", err)
+			throttled.Warning("cannot save the history", "error", err)
 		}
 	}
 
-	if notif.Debug {
-		log.Printf("updated")
+	sortSamples(items)
+	notif.recordLast(items)
+
+	for target := range due {
+		target.reschedule(now)
 	}
-}
+	notif.stats.tickDone(now, time.Since(begin), missed)
 
-func (notif *Notifier) Once(hostname string) {
-	var err error
+	logger.Debug("updated", "samples", len(items))
+	return Batch{
+		Time:    now,
+		Samples: items,
+		Events:  notif.pendingNotifications(),
+	}
+}
 
-	err = notif.Scan()
+// emit sends the batch to the sink.
+func (notif *Notifier) emit(b Batch) {
+	err := notif.flush(b.Samples, b.Events)
+	notif.flushDone(time.Now(), len(b.Samples), err)
 	if err != nil {
-		log.Printf("error during the collection setup: %v", err)
+		if notif.Queue != nil {
+			throttled.Error("cannot send the output", "error", err, "queued", notif.Queue.Len(), "dropped", notif.Queue.Dropped())
+		} else {
+			throttled.Error("cannot send the output", "error", err)
+		}
 	}
+}
 
-	// WARNING: we assume collection time is negligible
-	if notif.pr != nil {
-		err = notif.pr.Update()
-		if err != nil {
-			log.Printf("error during the kube update: %v", err)
-		}
+// Once collects all the targets, and sends the output to the sink.
+func (notif *Notifier) Once(hostname string) {
+	notif.Schedule(0)
+	err := notif.Step(hostname)
+	if err != nil {
+		logger.Error("cannot collect", "error", err)
 	}
+}
 
-	notif.Update(hostname, 0)
+// Step runs one iteration of the collection loop at the time given by
+// Clock, like Collect, and sends the output to the sink.
+func (notif *Notifier) Step(hostname string) error {
+	batch, err := notif.Collect(context.Background(), hostname)
+	if err != nil {
+		return err
+	}
+	notif.emit(batch)
+	return nil
 }
 
+// Loop collects the targets at the given interval, and sends the output
+// to the sink, until the tracked processes go stale and autoTrack is false.
 func (notif *Notifier) Loop(hostname string, interval time.Duration, autoTrack bool) {
-	c := time.Tick(interval)
-
-	log.Printf("collection started")
-	defer log.Printf("collection stopped")
+	for batch := range notif.Subscribe(context.Background(), hostname, interval, autoTrack) {
+		notif.emit(batch)
+	}
+}
 
+// step runs one iteration of the collection loop. Returns ErrStalePids
+// if the loop must stop.
+func (notif *Notifier) step(ctx context.Context, hostname string, now time.Time, autoTrack bool) (Batch, error) {
 	var err error
 
-	err = notif.Scan()
-	if err != nil {
-		log.Printf("error during the collection setup: %v", err)
+	// the CRI calls count against the tick deadline, and don't hold
+	// the lock, so a slow runtime doesn't block the requests from outside
+	ctx, cancel := notif.collectContext(ctx, now)
+	defer cancel()
+	if notif.pr != nil {
+		err = notif.updatePods(ctx)
+		if err != nil {
+			throttled.Warning("cannot update the pods", "error", err)
+		}
 	}
 
-	for _ = range c {
-		// WARNING: we assume collection time is negligible
-		if notif.pr != nil {
-			err = notif.pr.Update()
-			if err != nil {
-				log.Printf("error during the kube update: %v", err)
-			}
-		}
+	notif.lock.Lock()
+	defer notif.lock.Unlock()
 
-		if !notif.HasTargets() {
-			log.Printf("nothing to do...")
-			continue
+	if !notif.HasTargets() && autoTrack {
+		// processes may have been (re)started meanwhile
+		err = notif.Scan()
+		if err != nil {
+			throttled.Error("cannot scan, skipping the tick", "error", err)
+			return Batch{}, err
 		}
+	}
 
-		if !notif.IsCurrent() {
-			if !autoTrack {
-				log.Printf("stale pid(s) -- aborting!")
-				break
-			} else {
-				log.Printf("stale pid(s) -- rescanning!")
-				err = notif.Scan()
-				if err != nil {
-					log.Printf("error collecting: %v - skipping cycle", err)
-					continue
-				}
+	if !notif.HasTargets() {
+		throttled.Info("nothing to do")
+	} else if !notif.IsCurrent() {
+		if !autoTrack {
+			logger.Error("stale pid(s), stopping")
+			return Batch{}, ErrStalePids
+		} else {
+			throttled.Info("stale pid(s), rescanning")
+			err = notif.Scan()
+			if err != nil {
+				throttled.Error("cannot scan, skipping the tick", "error", err)
+				return Batch{}, err
 			}
 		}
+	}
 
-		notif.Update(hostname, int(interval.Seconds()))
+	err = notif.trackDescendants()
+	if err != nil {
+		throttled.Warning("cannot track the descendants", "error", err)
 	}
+
+	return notif.collectBatch(ctx, hostname, now), nil
 }
@@ -0,0 +1,350 @@
+package procnotify
+
+import (
+	"github.com/fromanirh/procwatch/procfs/procfstest"
+
+	"bytes"
+	"context"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+func newFakeProcFS(t *testing.T) *procfstest.FS {
+	fs := procfstest.New(t)
+	fs.Add(procfstest.Proc{Pid: 1, Argv: []string{"/usr/lib/systemd/systemd", "--system"}})
+	fs.Add(procfstest.Proc{
+		Pid:          2159,
+		PPid:         1,
+		Argv:         []string{"/usr/bin/python2", "/usr/share/vdsm/vdsmd"},
+		UTime:        1200,
+		STime:        300,
+		StartTime:    5000,
+		VSize:        512 << 20,
+		RSS:          64 << 20,
+		MinFlt:       4000,
+		MajFlt:       12,
+		Threads:      3,
+		FDs:          32,
+		CtxtSwitches: 900,
+		ReadBytes:    1 << 20,
+		WriteBytes:   4 << 20,
+		ReadOps:      100,
+		WriteOps:     400,
+	})
+	fs.Add(procfstest.Proc{Pid: 2192, PPid: 1, Argv: []string{"/usr/libexec/qemu-kvm", "-name", "vm1"}, StartTime: 6000})
+	return fs
+}
+
+func newFakeNotifier(metrics []string) *Notifier {
+	notif := NewNotifier([]Config{
+		{Name: "vdsm", Argv: []string{"/usr/bin/python2", "/usr/share/vdsm/vdsm*"}, Metrics: metrics},
+		{Name: "qemu", Argv: []string{"/usr/libexec/qemu-kvm"}, Metrics: metrics},
+	}, nil, "")
+	notif.Output = ioutil.Discard
+	return notif
+}
+
+func TestScan(t *testing.T) {
+	fs := newFakeProcFS(t)
+	defer fs.Remove()
+	defer fs.Use()()
+
+	notif := newFakeNotifier(nil)
+	err := notif.Scan()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !notif.HasTargets() {
+		t.Fatalf("no processes found")
+	}
+	if notif.btime != procfstest.BootTime {
+		t.Errorf("mismatch: btime %d expected %d", notif.btime, procfstest.BootTime)
+	}
+	if notif.scanStats.Entries != 3 || notif.scanStats.Matched != 2 {
+		t.Errorf("mismatch: %#v", notif.scanStats)
+	}
+	for _, target := range notif.targets {
+		if len(target.Pids) != 1 {
+			t.Errorf("mismatch: %s has pids %v", target.Name, target.Pids)
+		}
+	}
+}
+
+func TestIsCurrent(t *testing.T) {
+	fs := newFakeProcFS(t)
+	defer fs.Remove()
+	defer fs.Use()()
+
+	notif := newFakeNotifier(nil)
+	err := notif.Scan()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !notif.IsCurrent() {
+		t.Errorf("pids stale right after the scan")
+	}
+
+	// the pid was reused by something else
+	fs.Add(procfstest.Proc{Pid: 2192, PPid: 1, Argv: []string{"/usr/bin/sleep", "1d"}})
+	if notif.IsCurrent() {
+		t.Errorf("reused pid not detected")
+	}
+
+	fs.Kill(2192)
+	if notif.IsCurrent() {
+		t.Errorf("gone pid not detected")
+	}
+}
+
+func TestStepAutoTrack(t *testing.T) {
+	fs := newFakeProcFS(t)
+	defer fs.Remove()
+	defer fs.Use()()
+
+	notif := newFakeNotifier(nil)
+	notif.Schedule(time.Second)
+	err := notif.Scan()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// qemu restarted with another pid
+	fs.Kill(2192)
+	fs.Add(procfstest.Proc{Pid: 3000, PPid: 1, Argv: []string{"/usr/libexec/qemu-kvm", "-name", "vm1"}, StartTime: 9000})
+	_, err = notif.Collect(context.Background(), "node0")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	pids := notif.Status().Targets[1].Pids
+	if !reflect.DeepEqual(pids, []int32{3000}) {
+		t.Errorf("mismatch: qemu pids %v expected [3000]", pids)
+	}
+	if notif.targets[1].restarts != 1 {
+		t.Errorf("mismatch: %d restarts expected 1", notif.targets[1].restarts)
+	}
+
+	// all gone, and back later
+	fs.Kill(2159)
+	fs.Kill(3000)
+	_, err = notif.Collect(context.Background(), "node0")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if notif.HasTargets() {
+		t.Errorf("unexpected processes: %v", notif.procs)
+	}
+	fs.Add(procfstest.Proc{Pid: 3100, PPid: 1, Argv: []string{"/usr/libexec/qemu-kvm"}, StartTime: 9500})
+	notif.Collect(context.Background(), "node0")
+	if _, ok := notif.procs[3100]; !ok {
+		t.Errorf("restarted process not tracked: %v", notif.procs)
+	}
+}
+
+func TestLoopStale(t *testing.T) {
+	fs := newFakeProcFS(t)
+	defer fs.Remove()
+	defer fs.Use()()
+
+	notif := newFakeNotifier(nil)
+	done := make(chan struct{})
+	go func() {
+		notif.Loop("node0", 10*time.Millisecond, false)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for notif.Stats().Ticks == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case <-done:
+		t.Fatalf("loop stopped with current pids")
+	default:
+	}
+
+	fs.Kill(2192)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("loop not stopped with stale pids")
+	}
+}
+
+func TestCollect(t *testing.T) {
+	fs := newFakeProcFS(t)
+	defer fs.Remove()
+	defer fs.Use()()
+
+	notif := newFakeNotifier([]string{MetricsFDs})
+	notif.targets[1].Min = 1
+	var buf bytes.Buffer
+	notif.Output = &buf
+	batch, err := notif.Collect(context.Background(), "node0")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if buf.Len() > 0 {
+		t.Errorf("unexpected output: %s", buf.Bytes())
+	}
+	found := false
+	for _, item := range batch.Samples {
+		if item.Pid == 2159 && item.Name == "file_handles-open" {
+			found = item.Value == 32
+		}
+	}
+	if !found {
+		t.Errorf("missing samples: %v", batch.Samples)
+	}
+
+	// qemu gone
+	fs.Kill(2192)
+	batch, err = notif.Collect(context.Background(), "node0")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(batch.Events) != 1 || batch.Events[0].Target != "qemu" || batch.Events[0].Severity != SeverityFailure {
+		t.Errorf("mismatch: events %v", batch.Events)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	fs := newFakeProcFS(t)
+	defer fs.Remove()
+	defer fs.Use()()
+
+	notif := newFakeNotifier(nil)
+	var buf bytes.Buffer
+	notif.Output = &buf
+	ctx, cancel := context.WithCancel(context.Background())
+	batches := notif.Subscribe(ctx, "node0", 10*time.Millisecond, false)
+	for i := 0; i < 2; i++ {
+		select {
+		case batch := <-batches:
+			if len(batch.Samples) == 0 {
+				t.Errorf("empty batch")
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no batch delivered")
+		}
+	}
+	cancel()
+	for range batches {
+		// drain until the loop notices
+	}
+	if buf.Len() > 0 {
+		t.Errorf("unexpected output: %s", buf.Bytes())
+	}
+}
+
+func TestSubscribeNoInterval(t *testing.T) {
+	fs := newFakeProcFS(t)
+	defer fs.Remove()
+	defer fs.Use()()
+
+	for _, interval := range []time.Duration{0, -time.Second} {
+		notif := newFakeNotifier(nil)
+		batches := notif.Subscribe(context.Background(), "node0", interval, true)
+		select {
+		case _, ok := <-batches:
+			if ok {
+				t.Errorf("unexpected batch with interval %v", interval)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("loop started with interval %v", interval)
+		}
+	}
+}
+
+func TestUpdateOutput(t *testing.T) {
+	fs := newFakeProcFS(t)
+	defer fs.Remove()
+	defer fs.Use()()
+
+	metrics := []string{MetricsCPU, MetricsMemory, MetricsIO, MetricsFDs, MetricsThreads, MetricsFaults, MetricsUptime}
+	notif := newFakeNotifier(metrics)
+	var buf bytes.Buffer
+	notif.Output = &buf
+	now := time.Unix(1542710000, 0).UTC()
+	notif.Clock = func() time.Time { return now }
+	notif.Deadline = -1
+	notif.Schedule(5 * time.Second)
+	err := notif.Scan()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	notif.Update("node0", now)
+	// 2.5s of CPU time over 5s
+	fs.Add(procfstest.Proc{
+		Pid:          2159,
+		PPid:         1,
+		Argv:         []string{"/usr/bin/python2", "/usr/share/vdsm/vdsmd"},
+		UTime:        1400,
+		STime:        350,
+		StartTime:    5000,
+		VSize:        512 << 20,
+		RSS:          80 << 20,
+		MinFlt:       4200,
+		MajFlt:       12,
+		Threads:      4,
+		FDs:          40,
+		CtxtSwitches: 1000,
+		ReadBytes:    2 << 20,
+		WriteBytes:   4 << 20,
+		ReadOps:      150,
+		WriteOps:     400,
+	})
+	now = now.Add(5 * time.Second)
+	notif.Update("node0", now)
+
+	golden := filepath.Join("testdata", "update.golden")
+	if *update {
+		err = ioutil.WriteFile(golden, buf.Bytes(), 0644)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	expected, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !bytes.Equal(buf.Bytes(), expected) {
+		t.Errorf("mismatch:\ngot\n%s\nexpected\n%s", buf.Bytes(), expected)
+	}
+}
+
+func TestCollectDeadline(t *testing.T) {
+	fs := newFakeProcFS(t)
+	defer fs.Remove()
+	defer fs.Use()()
+
+	var running int32
+	collectors["slow"] = func(notif *Notifier, proc Proc, s *samples) error {
+		atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		time.Sleep(50 * time.Millisecond)
+		return nil
+	}
+	defer delete(collectors, "slow")
+
+	notif := newFakeNotifier([]string{"slow", MetricsFDs})
+	notif.Workers = 1
+	notif.Deadline = 10 * time.Millisecond
+	_, err := notif.Collect(context.Background(), "node0")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if n := atomic.LoadInt32(&running); n != 0 {
+		t.Errorf("%d workers still running after the collection", n)
+	}
+	if notif.Stats().Timeouts != 2 {
+		t.Errorf("mismatch: %d timeouts expected 2", notif.Stats().Timeouts)
+	}
+}
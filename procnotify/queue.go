@@ -0,0 +1,208 @@
+package procnotify
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Drop policies, telling what to discard when the queue is full
+const (
+	DropOldest = "oldest"
+	DropNewest = "newest"
+)
+
+// DefaultQueueSize is the number of lines kept while the sink is down:
+// roughly ten minutes of a few targets at the default interval.
+const DefaultQueueSize = 10000
+
+// QueueConfig tunes the buffering of the output while the sink is unavailable.
+type QueueConfig struct {
+	// Size is the max number of pending lines (samples and notifications)
+	Size int `json:"size"`
+	// Path is the file pending lines are spooled to, to survive restarts.
+	// If empty, the queue is memory only.
+	Path string `json:"path"`
+	// Drop is the drop policy when the queue is full, see Drop*
+	Drop string `json:"drop"`
+}
+
+func (qc QueueConfig) Validate() error {
+	if qc.Size < 0 {
+		return fmt.Errorf("queue: negative size: %d", qc.Size)
+	}
+	switch qc.Drop {
+	case "", DropOldest, DropNewest:
+		return nil
+	}
+	return fmt.Errorf("queue: unknown drop policy: %q", qc.Drop)
+}
+
+// Queue retains the lines not yet accepted by the sink, in order.
+// Lines are already formatted, so they keep their original timestamps.
+type Queue struct {
+	conf    QueueConfig
+	lock    sync.Mutex
+	lines   []string
+	dropped uint64
+	// spooled is the number of queued lines already in the spool file
+	spooled int
+	// rewrite is set once lines leave the head of the queue, so the
+	// spool file can't just be appended to anymore
+	rewrite bool
+}
+
+// NewQueue creates the queue, reading back the lines spooled by a previous run.
+func NewQueue(conf QueueConfig) (*Queue, error) {
+	if conf.Size == 0 {
+		conf.Size = DefaultQueueSize
+	}
+	if conf.Drop == "" {
+		conf.Drop = DropOldest
+	}
+	q := &Queue{conf: conf}
+	if conf.Path == "" {
+		return q, nil
+	}
+	f, err := os.Open(conf.Path)
+	if os.IsNotExist(err) {
+		return q, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	var lines []string
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	err = scanner.Err()
+	if err != nil {
+		return nil, err
+	}
+	q.push(lines)
+	q.spooled = len(q.lines)
+	q.rewrite = len(q.lines) < len(lines)
+	return q, q.sync()
+}
+
+// Len returns the number of pending lines.
+func (q *Queue) Len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return len(q.lines)
+}
+
+// Dropped returns the number of lines discarded because the queue was full.
+func (q *Queue) Dropped() uint64 {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return q.dropped
+}
+
+// push must be called with the lock held
+func (q *Queue) push(lines []string) {
+	for _, line := range lines {
+		if len(q.lines) < q.conf.Size {
+			q.lines = append(q.lines, line)
+			continue
+		}
+		q.dropped++
+		if q.conf.Drop == DropOldest {
+			q.lines = append(q.lines[1:], line)
+			q.rewrite = true
+		}
+	}
+}
+
+// sync brings the spool file up to date. Must be called with the lock held.
+func (q *Queue) sync() error {
+	if q.conf.Path == "" {
+		return nil
+	}
+	if q.rewrite {
+		err := q.writeSpool(os.O_CREATE|os.O_WRONLY|os.O_TRUNC, q.lines)
+		if err != nil {
+			return err
+		}
+		q.rewrite = false
+	} else if q.spooled < len(q.lines) {
+		err := q.writeSpool(os.O_CREATE|os.O_WRONLY|os.O_APPEND, q.lines[q.spooled:])
+		if err != nil {
+			return err
+		}
+	}
+	q.spooled = len(q.lines)
+	return nil
+}
+
+func (q *Queue) writeSpool(flag int, lines []string) error {
+	f, err := os.OpenFile(q.conf.Path, flag, 0644)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for _, line := range lines {
+		fmt.Fprintf(w, "%s\n", line)
+	}
+	err = w.Flush()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Send writes to the sink returned by dial the pending lines, then the given
+// ones, in order. On failure, what was not accepted is queued.
+func (q *Queue) Send(lines []string, dial func() (Sink, error)) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	err := q.write(lines, dial)
+	syncErr := q.sync()
+	if err != nil {
+		return err
+	}
+	return syncErr
+}
+
+func (q *Queue) write(lines []string, dial func() (Sink, error)) error {
+	if len(q.lines) == 0 && len(lines) == 0 {
+		return nil
+	}
+	sink, err := dial()
+	if err != nil {
+		q.push(lines)
+		return err
+	}
+	defer sink.Close()
+
+	pending := append(q.lines, lines...)
+	sent := 0
+	for _, line := range pending {
+		err = sink.Send(line)
+		if err != nil {
+			break
+		}
+		sent++
+	}
+	// no need to touch the spool if nothing was in it
+	q.rewrite = q.rewrite || (sent > 0 && q.spooled > 0)
+	q.lines = nil
+	q.push(pending[sent:])
+	return err
+}
+
+func formatLines(items []Sample, notes []Event) []string {
+	lines := make([]string, 0, len(items)+len(notes))
+	for _, item := range items {
+		lines = append(lines, item.String())
+	}
+	for _, note := range notes {
+		lines = append(lines, note.String())
+	}
+	return lines
+}
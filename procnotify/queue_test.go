@@ -0,0 +1,183 @@
+package procnotify
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var errSinkDown = errors.New("sink down")
+
+type fakeSink struct {
+	up  bool
+	buf bytes.Buffer
+}
+
+func (fs *fakeSink) dial() (Sink, error) {
+	if !fs.up {
+		return nil, errSinkDown
+	}
+	return writerSink{&fs.buf}, nil
+}
+
+func TestQueueReplay(t *testing.T) {
+	sink := &fakeSink{}
+	q, err := NewQueue(QueueConfig{Size: 3})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for _, line := range []string{"a", "b", "c", "d"} {
+		err = q.Send([]string{line}, sink.dial)
+		if err != errSinkDown {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if q.Len() != 3 || q.Dropped() != 1 {
+		t.Errorf("unexpected queue: len=%d dropped=%d", q.Len(), q.Dropped())
+	}
+
+	sink.up = true
+	err = q.Send([]string{"e"}, sink.dial)
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if sink.buf.String() != "b\nc\nd\ne\n" {
+		t.Errorf("mismatch: %q", sink.buf.String())
+	}
+	if q.Len() != 0 {
+		t.Errorf("unexpected pending lines: %d", q.Len())
+	}
+}
+
+func TestQueueDropNewest(t *testing.T) {
+	sink := &fakeSink{}
+	q, err := NewQueue(QueueConfig{Size: 2, Drop: DropNewest})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	q.Send([]string{"a", "b", "c"}, sink.dial)
+
+	sink.up = true
+	q.Send(nil, sink.dial)
+	if sink.buf.String() != "a\nb\n" {
+		t.Errorf("mismatch: %q", sink.buf.String())
+	}
+}
+
+func TestQueueSpool(t *testing.T) {
+	dir, err := ioutil.TempDir("", "procnotify")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "spool")
+
+	sink := &fakeSink{}
+	q, err := NewQueue(QueueConfig{Path: path})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	q.Send([]string{"a", "b"}, sink.dial)
+	q.Send([]string{"c"}, sink.dial)
+
+	// as if procwatch was restarted
+	q, err = NewQueue(QueueConfig{Path: path})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if q.Len() != 3 {
+		t.Errorf("unexpected pending lines: %d", q.Len())
+	}
+
+	sink.up = true
+	err = q.Send([]string{"d"}, sink.dial)
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if sink.buf.String() != "a\nb\nc\nd\n" {
+		t.Errorf("mismatch: %q", sink.buf.String())
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil || strings.TrimSpace(string(data)) != "" {
+		t.Errorf("spool not emptied: %q (%v)", data, err)
+	}
+}
+
+// fakeCollectd acks the first n commands, then stops replying.
+func fakeCollectd(t *testing.T, path string, n int) (net.Listener, chan []string) {
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	got := make(chan []string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			got <- nil
+			return
+		}
+		defer conn.Close()
+		var lines []string
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+			if len(lines) <= n {
+				io.WriteString(conn, "0 Success: 1 value has been dispatched.\n")
+			} else {
+				break
+			}
+		}
+		got <- lines
+	}()
+	return ln, got
+}
+
+func TestQueueUnixSockAck(t *testing.T) {
+	dir, err := ioutil.TempDir("", "procnotify")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "collectd.sock")
+	defer func(timeout time.Duration) { sinkTimeout = timeout }(sinkTimeout)
+	sinkTimeout = 100 * time.Millisecond
+
+	ln, got := fakeCollectd(t, path, 2)
+	defer ln.Close()
+	q, err := NewQueue(QueueConfig{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	dial := func() (Sink, error) {
+		return dialUnixSock(path)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- q.Send([]string{"a", "b", "c", "d"}, dial)
+	}()
+	select {
+	case err = <-done:
+		if err == nil {
+			t.Errorf("expected error on the unacknowledged line")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("send blocked on the unresponsive sink")
+	}
+	if lines := <-got; !reflect.DeepEqual(lines, []string{"a", "b", "c"}) {
+		t.Errorf("mismatch: %q", lines)
+	}
+	// the line written but not acknowledged is not lost
+	if q.Len() != 2 {
+		t.Errorf("unexpected pending lines: %d", q.Len())
+	}
+}
@@ -0,0 +1,98 @@
+package procnotify
+
+import (
+	"github.com/fromanirh/procwatch/procfs"
+
+	"fmt"
+	"time"
+)
+
+// trackRestarts compares the processes found by the last scan, identified
+// by PID and start time, with the ones found before, and counts as restart
+// every process gone and replaced by a new one, even across scans.
+func (t *Target) trackRestarts(current map[int32]uint64) {
+	if t.known == nil {
+		t.known = current
+		return
+	}
+
+	var gone, appeared []int32
+	for pid, start := range t.known {
+		if cur, ok := current[pid]; !ok || cur != start {
+			gone = append(gone, pid)
+		}
+	}
+	for pid, start := range current {
+		if prev, ok := t.known[pid]; !ok || prev != start {
+			appeared = append(appeared, pid)
+		}
+	}
+	t.known = current
+
+	t.pendingGone += len(gone)
+	restarts := t.pendingGone
+	if len(appeared) < restarts {
+		restarts = len(appeared)
+	}
+	t.pendingGone -= restarts
+	t.restarts += uint64(restarts)
+
+	if restarts > 0 {
+		logger.Info("restart detected", "target", t.Name, "gone", gone, "appeared", appeared, "restarts", t.restarts)
+	} else if len(gone) > 0 {
+		logger.Info("process(es) gone", "target", t.Name, "gone", gone)
+	}
+}
+
+func (notif *Notifier) trackRestarts() {
+	for _, target := range notif.targets {
+		current := make(map[int32]uint64)
+		for _, pid := range target.Pids {
+			st, err := procfs.ReadStat(int32(pid))
+			if err != nil {
+				continue
+			}
+			current[int32(pid)] = st.StartTime
+		}
+		target.trackRestarts(current)
+	}
+}
+
+func collectUptime(notif *Notifier, proc Proc, s *samples) error {
+	st, err := procfs.ReadStat(proc.p.Pid)
+	if err != nil {
+		return err
+	}
+	started := float64(notif.btime) + float64(st.StartTime)/procfs.UserHZ
+	s.add("gauge-start_time", started)
+	s.add("uptime", float64(s.time.UnixNano())/float64(time.Second)-started)
+	return nil
+}
+
+// targetSamples returns the samples which describe the due targets
+// as a whole.
+func (notif *Notifier) targetSamples(hostname string, due map[*Target]bool) []Sample {
+	var items []Sample
+	now := notif.now()
+	counts := notif.countInstances()
+	for _, target := range notif.targets {
+		if !due[target] {
+			continue
+		}
+		s := &samples{
+			target:   target.Name,
+			ident:    fmt.Sprintf("%s/exec-%s", hostname, target.Name),
+			interval: int(target.interval.Seconds()),
+			time:     now,
+		}
+		s.add("derive-restarts", float64(target.restarts))
+		s.add("count-instances", float64(counts[target]))
+		up := 0.0
+		if notif.checkInstances(hostname, target, counts[target], now) {
+			up = 1.0
+		}
+		s.add("gauge-up", up)
+		items = append(items, s.items...)
+	}
+	return items
+}
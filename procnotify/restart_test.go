@@ -0,0 +1,42 @@
+package procnotify
+
+import (
+	"testing"
+)
+
+func TestTrackRestarts(t *testing.T) {
+	target := &Target{Config: Config{Name: "libvirtd"}}
+
+	target.trackRestarts(map[int32]uint64{100: 5000})
+	if target.restarts != 0 {
+		t.Errorf("unexpected restarts on first scan: %d", target.restarts)
+	}
+
+	// same process, rescanned
+	target.trackRestarts(map[int32]uint64{100: 5000})
+	if target.restarts != 0 {
+		t.Errorf("unexpected restarts: %d", target.restarts)
+	}
+
+	// crashed, and restarted before the next scan
+	target.trackRestarts(map[int32]uint64{120: 6000})
+	if target.restarts != 1 {
+		t.Errorf("unexpected restarts: %d", target.restarts)
+	}
+
+	// crashed, and restarted only after the next scan
+	target.trackRestarts(map[int32]uint64{})
+	if target.restarts != 1 {
+		t.Errorf("unexpected restarts: %d", target.restarts)
+	}
+	target.trackRestarts(map[int32]uint64{130: 7000})
+	if target.restarts != 2 {
+		t.Errorf("unexpected restarts: %d", target.restarts)
+	}
+
+	// PID reused by the new instance
+	target.trackRestarts(map[int32]uint64{130: 8000})
+	if target.restarts != 3 {
+		t.Errorf("unexpected restarts: %d", target.restarts)
+	}
+}
@@ -0,0 +1,210 @@
+package procnotify
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Rule raises a notification when a metric of a target crosses a threshold
+// for a given number of consecutive samples and/or a given time.
+// Values are compared in the units they are reported in (e.g. KiB for
+// memory-resident).
+type Rule struct {
+	Name   string  `json:"name"`
+	Metric string  `json:"metric"`
+	Op     string  `json:"op"`
+	Value  float64 `json:"value"`
+	// Ticks is the number of consecutive samples crossing the threshold
+	// needed to fire. Default is one.
+	Ticks int `json:"ticks"`
+	// For is how long the threshold must be crossed to fire.
+	For Duration `json:"for"`
+	// Hysteresis is how far back from the threshold the metric must go
+	// to resolve the notification.
+	Hysteresis float64 `json:"hysteresis"`
+	// Severity of the notification: warning (default) or failure.
+	Severity string `json:"severity"`
+}
+
+func (r Rule) String() string {
+	if r.Name != "" {
+		return r.Name
+	}
+	return fmt.Sprintf("%s %s %v", r.Metric, r.Op, r.Value)
+}
+
+func (r Rule) Validate() error {
+	if r.Metric == "" {
+		return fmt.Errorf("rule %q: missing metric", r)
+	}
+	switch r.Op {
+	case ">", ">=", "<", "<=":
+	default:
+		return fmt.Errorf("rule %q: unknown operator: %q", r, r.Op)
+	}
+	switch r.Severity {
+	case "", SeverityWarning, SeverityFailure:
+	default:
+		return fmt.Errorf("rule %q: unknown severity: %q", r, r.Severity)
+	}
+	if r.Ticks < 0 || r.For.Duration < 0 || r.Hysteresis < 0 {
+		return fmt.Errorf("rule %q: negative ticks, duration or hysteresis", r)
+	}
+	return nil
+}
+
+func (r Rule) crossed(value float64) bool {
+	switch r.Op {
+	case ">":
+		return value > r.Value
+	case ">=":
+		return value >= r.Value
+	case "<":
+		return value < r.Value
+	case "<=":
+		return value <= r.Value
+	}
+	return false
+}
+
+// recovered tells if the value went back far enough from the threshold
+// to resolve the notification.
+func (r Rule) recovered(value float64) bool {
+	if strings.HasPrefix(r.Op, ">") {
+		return value <= r.Value-r.Hysteresis
+	}
+	return value >= r.Value+r.Hysteresis
+}
+
+type ruleKey struct {
+	target string
+	rule   int
+	ident  string
+}
+
+type ruleState struct {
+	count    int
+	since    time.Time
+	firing   bool
+	lastSeen time.Time
+}
+
+// pluginInstance extracts the collectd plugin instance from the sample
+// identifier: "host/exec-libvirtd-1234" -> "libvirtd-1234"
+func pluginInstance(ident string) string {
+	items := strings.SplitN(ident, "/", 2)
+	return strings.TrimPrefix(items[len(items)-1], "exec-")
+}
+
+// evaluateRules checks the rules of the due targets against the samples
+// just collected, and notifies the ones starting and stopping to fire.
+func (notif *Notifier) evaluateRules(hostname string, due map[*Target]bool, items []Sample, now time.Time) {
+	targets := make(map[string]*Target)
+	for target := range due {
+		if len(target.Rules) > 0 {
+			targets[target.Name] = target
+		}
+	}
+	if len(targets) == 0 {
+		return
+	}
+	if notif.ruleStates == nil {
+		notif.ruleStates = make(map[ruleKey]*ruleState)
+	}
+
+	for _, item := range items {
+		target, ok := targets[item.Target]
+		if !ok {
+			continue
+		}
+		for idx, rule := range target.Rules {
+			if rule.Metric != item.Name {
+				continue
+			}
+			key := ruleKey{target: target.Name, rule: idx, ident: item.Ident}
+			st, ok := notif.ruleStates[key]
+			if !ok {
+				st = &ruleState{}
+				notif.ruleStates[key] = st
+			}
+			st.lastSeen = now
+			notif.evaluateRule(hostname, target, rule, st, item, now)
+		}
+	}
+
+	// a rule state missing two collections of its target belongs to a
+	// series gone for good, like the one of a dead process
+	for key, st := range notif.ruleStates {
+		target, ok := targets[key.target]
+		if !ok || !now.After(st.lastSeen.Add(2*target.interval)) {
+			continue
+		}
+		if st.firing {
+			rule := target.Rules[key.rule]
+			notif.notifyGone(hostname, now, target.Name, key.ident, rule.Metric,
+				fmt.Sprintf("rule %q resolved: no longer reported", rule))
+		}
+		delete(notif.ruleStates, key)
+	}
+}
+
+// notifyGone resolves the notification raised for a series which is
+// no longer reported.
+func (notif *Notifier) notifyGone(hostname string, now time.Time, target, ident, metric, message string) {
+	notif.notify(Event{
+		Severity: SeverityOkay,
+		Time:     now,
+		Host:     hostname,
+		Target:   target,
+		Instance: pluginInstance(ident),
+		Metric:   metric,
+		Message:  message,
+	})
+}
+
+func (notif *Notifier) evaluateRule(hostname string, target *Target, rule Rule, st *ruleState, item Sample, now time.Time) {
+	n := Event{
+		Time:     now,
+		Host:     hostname,
+		Target:   target.Name,
+		Instance: pluginInstance(item.Ident),
+		Metric:   item.Name,
+	}
+
+	if st.firing {
+		if rule.recovered(item.Value) {
+			st.firing = false
+			st.count = 0
+			n.Severity = SeverityOkay
+			n.Message = fmt.Sprintf("rule %q resolved: value %v", rule, item.Value)
+			notif.notify(n)
+		}
+		return
+	}
+
+	if !rule.crossed(item.Value) {
+		st.count = 0
+		return
+	}
+	if st.count == 0 {
+		st.since = now
+	}
+	st.count++
+
+	ticks := rule.Ticks
+	if ticks == 0 {
+		ticks = 1
+	}
+	if st.count < ticks || now.Sub(st.since) < rule.For.Duration {
+		return
+	}
+
+	st.firing = true
+	n.Severity = rule.Severity
+	if n.Severity == "" {
+		n.Severity = SeverityWarning
+	}
+	n.Message = fmt.Sprintf("rule %q fired: value %v", rule, item.Value)
+	notif.notify(n)
+}
@@ -0,0 +1,101 @@
+package procnotify
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEvaluateRules(t *testing.T) {
+	notif := NewNotifier([]Config{
+		{
+			Name: "vdsm",
+			Argv: []string{"vdsm"},
+			Rules: []Rule{
+				{Metric: "memory-resident", Op: ">", Value: 2097152, Ticks: 3, Hysteresis: 1024},
+			},
+		},
+	}, nil, "")
+	notif.Schedule(time.Second)
+	due := map[*Target]bool{notif.targets[0]: true}
+	start := time.Unix(1539000000, 0)
+
+	type testcase struct {
+		value    float64
+		severity string
+	}
+	testcases := []testcase{
+		{value: 2000000},
+		{value: 2100000},
+		{value: 2100000},
+		{value: 2100000, severity: SeverityWarning},
+		{value: 2200000},
+		// within the hysteresis: still firing
+		{value: 2096640},
+		{value: 2096000, severity: SeverityOkay},
+		{value: 2100000},
+	}
+	for idx, tcase := range testcases {
+		items := []Sample{
+			{Target: "vdsm", Pid: 42, Ident: "host/exec-vdsm-42", Name: "memory-resident", Value: tcase.value},
+		}
+		notif.evaluateRules("host", due, items, start.Add(time.Duration(idx)*time.Second))
+		notes := notif.pendingNotifications()
+		if tcase.severity == "" && len(notes) > 0 {
+			t.Errorf("#%d: unexpected notifications: %v", idx, notes)
+		}
+		if tcase.severity != "" && (len(notes) != 1 || notes[0].Severity != tcase.severity || notes[0].Instance != "vdsm-42") {
+			t.Errorf("#%d: unexpected notifications: %v", idx, notes)
+		}
+	}
+}
+
+func TestEvaluateRulesFor(t *testing.T) {
+	notif := NewNotifier([]Config{
+		{
+			Name: "qemu",
+			Argv: []string{"qemu"},
+			Rules: []Rule{
+				{Metric: "percent-cpu", Op: ">", Value: 90, For: Duration{time.Minute}, Severity: SeverityFailure},
+			},
+		},
+	}, nil, "")
+	notif.Schedule(10 * time.Second)
+	due := map[*Target]bool{notif.targets[0]: true}
+	start := time.Unix(1539000000, 0)
+
+	fired := -1
+	for idx := 0; idx < 10; idx++ {
+		items := []Sample{
+			{Target: "qemu", Pid: 7, Ident: "host/exec-qemu-7", Name: "percent-cpu", Value: 95},
+		}
+		notif.evaluateRules("host", due, items, start.Add(time.Duration(idx)*10*time.Second))
+		for _, note := range notif.pendingNotifications() {
+			if note.Severity == SeverityFailure && fired < 0 {
+				fired = idx
+			}
+		}
+	}
+	if fired != 6 {
+		t.Errorf("rule fired at sample #%d", fired)
+	}
+
+	// process gone: the notification is resolved
+	notif.evaluateRules("host", due, nil, start.Add(200*time.Second))
+	notes := notif.pendingNotifications()
+	if len(notes) != 1 || notes[0].Severity != SeverityOkay {
+		t.Errorf("unexpected notifications: %v", notes)
+	}
+}
+
+func TestRuleValidate(t *testing.T) {
+	rules := []Rule{
+		{Metric: "percent-cpu", Op: "=>", Value: 90},
+		{Op: ">", Value: 90},
+		{Metric: "percent-cpu", Op: ">", Value: 90, Severity: "critical"},
+	}
+	for _, rule := range rules {
+		if err := rule.Validate(); err == nil {
+			t.Errorf("unexpected success for %#v", rule)
+		}
+	}
+}
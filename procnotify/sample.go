@@ -0,0 +1,82 @@
+package procnotify
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Sample is a value collected for a process or a target.
+type Sample struct {
+	Target string `json:"target"`
+	Pid    int32  `json:"pid,omitempty"`
+	// Parent is the matched process the process descends from, if any
+	Parent int32 `json:"parent,omitempty"`
+	// Ident is the collectd identifier, without the type: host/plugin-instance
+	Ident string `json:"ident"`
+	// Name is the collectd type and type instance: type-instance
+	Name     string    `json:"name"`
+	Interval int       `json:"interval"`
+	Time     time.Time `json:"time"`
+	Value    float64   `json:"value"`
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "N"
+	}
+	return strconv.FormatFloat(float64(t.UnixNano())/float64(time.Second), 'f', 3, 64)
+}
+
+func (s Sample) String() string {
+	return fmt.Sprintf("PUTVAL %s/%s interval=%d %s:%s", s.Ident, s.Name, s.Interval,
+		formatTime(s.Time), strconv.FormatFloat(s.Value, 'f', -1, 64))
+}
+
+// samples accumulates the values collected for a process, all sharing
+// the same identifier, interval and collection time.
+type samples struct {
+	target   string
+	pid      int32
+	parent   int32
+	ident    string
+	interval int
+	time     time.Time
+	items    []Sample
+}
+
+func (s *samples) add(name string, value float64) {
+	s.items = append(s.items, Sample{
+		Target:   s.target,
+		Pid:      s.pid,
+		Parent:   s.parent,
+		Ident:    s.ident,
+		Name:     name,
+		Interval: s.interval,
+		Time:     s.time,
+		Value:    value,
+	})
+}
+
+func (notif *Notifier) flush(items []Sample, notes []Event) error {
+	lines := formatLines(items, notes)
+	if notif.Queue != nil {
+		return notif.Queue.Send(lines, notif.dial)
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+
+	sink, err := notif.dial()
+	if err != nil {
+		return err
+	}
+	defer sink.Close()
+	for _, line := range lines {
+		err = sink.Send(line)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
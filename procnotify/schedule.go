@@ -0,0 +1,99 @@
+package procnotify
+
+import (
+	"context"
+	"time"
+)
+
+func gcd(a, b time.Duration) time.Duration {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// Schedule resolves the collection interval of each target, falling back
+// to the given interval for the targets which don't set their own, and
+// returns the base tick the collection loop needs to run at to service
+// every target on its own cadence.
+func (notif *Notifier) Schedule(interval time.Duration) time.Duration {
+	var tick time.Duration
+	for _, target := range notif.targets {
+		target.interval = target.Interval.Duration
+		if target.interval == 0 {
+			target.interval = interval
+		}
+		target.next = time.Time{}
+		if target.interval > 0 {
+			tick = gcd(tick, target.interval)
+		}
+	}
+	if tick == 0 {
+		tick = interval
+	}
+	notif.tick = tick
+	return tick
+}
+
+// isDue tells if the target must be collected at the given time,
+// tolerating up to `slack` of timer jitter.
+func (t *Target) isDue(now time.Time, slack time.Duration) bool {
+	return !now.Add(slack).Before(t.next)
+}
+
+func (t *Target) reschedule(now time.Time) {
+	t.next = t.next.Add(t.interval)
+	if t.next.Before(now) {
+		t.next = now.Add(t.interval)
+	}
+}
+
+func (notif *Notifier) dueTargets(now time.Time) map[*Target]bool {
+	due := make(map[*Target]bool)
+	for _, target := range notif.targets {
+		if target.isDue(now, notif.tick/2) {
+			due[target] = true
+		}
+	}
+	return due
+}
+
+// ticker fires at multiples of the tick from its start time. Unlike
+// time.Ticker, it never queues nor silently drops ticks: callers are
+// told how many ticks they missed, and the schedule never drifts.
+type ticker struct {
+	tick time.Duration
+	next time.Time
+}
+
+func newTicker(tick time.Duration, start time.Time) *ticker {
+	return &ticker{
+		tick: tick,
+		next: start.Add(tick),
+	}
+}
+
+// wait blocks until the next tick, and returns its scheduled time,
+// or false if the context is done first.
+func (tk *ticker) wait(ctx context.Context) (time.Time, bool) {
+	timer := time.NewTimer(time.Until(tk.next))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return tk.next, true
+	case <-ctx.Done():
+		return time.Time{}, false
+	}
+}
+
+// advance moves to the next tick in the future, and returns the number
+// of ticks skipped because they already elapsed at the given time.
+func (tk *ticker) advance(now time.Time) int {
+	tk.next = tk.next.Add(tk.tick)
+	if now.Before(tk.next) {
+		return 0
+	}
+	skipped := int(now.Sub(tk.next)/tk.tick) + 1
+	tk.next = tk.next.Add(time.Duration(skipped) * tk.tick)
+	return skipped
+}
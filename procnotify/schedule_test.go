@@ -0,0 +1,53 @@
+package procnotify
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleTick(t *testing.T) {
+	notif := NewNotifier([]Config{
+		{Name: "vdsm", Argv: []string{"vdsm"}, Interval: Duration{2 * time.Second}},
+		{Name: "libvirtd", Argv: []string{"libvirtd"}, Interval: Duration{5 * time.Second}},
+		{Name: "qemu", Argv: []string{"qemu"}},
+	}, nil, "")
+	tick := notif.Schedule(10 * time.Second)
+	if tick != time.Second {
+		t.Errorf("unexpected tick: %v", tick)
+	}
+
+	now := time.Now()
+	due := notif.dueTargets(now)
+	if len(due) != 3 {
+		t.Errorf("expected all targets due at start, got %d", len(due))
+	}
+	for target := range due {
+		target.reschedule(now)
+	}
+
+	due = notif.dueTargets(now.Add(2 * time.Second))
+	if len(due) != 1 || !due[notif.targets[0]] {
+		t.Errorf("expected only vdsm due after 2s, got %v", due)
+	}
+}
+
+func TestTickerAdvance(t *testing.T) {
+	start := time.Now()
+	tk := newTicker(time.Second, start)
+
+	now := tk.next
+	if skipped := tk.advance(now.Add(100 * time.Millisecond)); skipped != 0 {
+		t.Errorf("unexpected skipped ticks: %d", skipped)
+	}
+	if !tk.next.Equal(start.Add(2 * time.Second)) {
+		t.Errorf("unexpected next tick: %v", tk.next.Sub(start))
+	}
+
+	// collection of the second tick took 2.5s: ticks at 3s and 4s are gone
+	if skipped := tk.advance(tk.next.Add(2500 * time.Millisecond)); skipped != 2 {
+		t.Errorf("unexpected skipped ticks: %d", skipped)
+	}
+	if !tk.next.Equal(start.Add(5 * time.Second)) {
+		t.Errorf("unexpected next tick: %v", tk.next.Sub(start))
+	}
+}
@@ -0,0 +1,53 @@
+package procnotify
+
+import (
+	"fmt"
+	"time"
+)
+
+// SelfName is the plugin instance procwatch reports its own metrics under.
+const SelfName = "procwatch"
+
+// selfSamples returns the metrics about procwatch itself: how expensive
+// the scans and the collection are, and how the CRI calls and the sink are doing.
+func (notif *Notifier) selfSamples(hostname string, now time.Time) []Sample {
+	interval := int(notif.tick.Seconds())
+	if interval < 1 {
+		interval = 1
+	}
+	s := &samples{
+		target:   SelfName,
+		ident:    fmt.Sprintf("%s/exec-%s", hostname, SelfName),
+		interval: interval,
+		time:     now,
+	}
+
+	s.add("duration-scan", notif.scanStats.Duration.Seconds())
+	s.add("count-proc_entries", float64(notif.scanStats.Entries))
+	for _, target := range notif.targets {
+		s.add("count-matched_"+instanceName(target.Name), float64(len(target.Pids)))
+	}
+
+	stats := notif.Stats()
+	s.add("duration-tick", stats.LastDuration.Seconds())
+	s.add("derive-overruns", float64(stats.Overruns))
+	s.add("derive-skipped_ticks", float64(stats.SkippedTicks))
+	s.add("derive-timeouts", float64(stats.Timeouts))
+
+	if notif.pr != nil {
+		cri := notif.pr.Stats()
+		s.add("derive-cri_calls", float64(cri.Calls))
+		s.add("derive-cri_errors", float64(cri.Errors))
+		s.add("duration-cri_latency_containers", cri.ContainersLatency.Seconds())
+		s.add("duration-cri_latency_pods", cri.PodsLatency.Seconds())
+	}
+
+	sink := notif.sinkStatus()
+	s.add("derive-samples", float64(sink.Samples))
+	s.add("derive-sink_errors", float64(sink.Errors))
+	if notif.Queue != nil {
+		s.add("gauge-queue_pending", float64(sink.Pending))
+		s.add("derive-queue_dropped", float64(sink.Dropped))
+	}
+	return s.items
+}
@@ -0,0 +1,39 @@
+package procnotify
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSelfSamples(t *testing.T) {
+	notif := NewNotifier([]Config{{Name: "vdsm", Argv: []string{"vdsm"}}}, nil, "")
+	notif.Schedule(5 * time.Second)
+	notif.targets[0].Pids = append(notif.targets[0].Pids, 42, 43)
+	notif.scanStats.Entries = 300
+	notif.flushDone(time.Now(), 10, nil)
+	notif.flushDone(time.Now(), 5, errors.New("connection refused"))
+
+	got := make(map[string]float64)
+	for _, item := range notif.selfSamples("host", time.Now()) {
+		if item.Ident != "host/exec-procwatch" || item.Interval != 5 {
+			t.Errorf("unexpected sample: %v", item)
+		}
+		got[item.Name] = item.Value
+	}
+	expected := map[string]float64{
+		"count-proc_entries": 300,
+		"count-matched_vdsm": 2,
+		"derive-samples":     10,
+		"derive-sink_errors": 1,
+		"derive-overruns":    0,
+	}
+	for name, value := range expected {
+		if v, ok := got[name]; !ok || v != value {
+			t.Errorf("mismatch for %s: %v", name, v)
+		}
+	}
+	if _, ok := got["derive-cri_calls"]; ok {
+		t.Errorf("unexpected CRI metrics without pod resolution")
+	}
+}
@@ -0,0 +1,93 @@
+package procnotify
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// sinkTimeout bounds the connection to the unix socket and each command
+// sent over it; replaced by the tests.
+var sinkTimeout = 10 * time.Second
+
+// Sink receives the output, one line at a time. Send returns once the
+// line is accepted.
+type Sink interface {
+	Send(line string) error
+	Close() error
+}
+
+// dial connects to the sink: Output if set, the unix socket if configured,
+// stdout otherwise.
+func (notif *Notifier) dial() (Sink, error) {
+	if notif.Output != nil {
+		return writerSink{notif.Output}, nil
+	}
+	if notif.sinkPath == "" {
+		return writerSink{os.Stdout}, nil
+	}
+	sink, err := dialUnixSock(notif.sinkPath)
+	if err != nil {
+		return nil, err
+	}
+	return sink, nil
+}
+
+// writerSink writes the lines as they are, expecting no reply.
+type writerSink struct {
+	w io.Writer
+}
+
+func (ws writerSink) Send(line string) error {
+	_, err := io.WriteString(ws.w, line+"\n")
+	return err
+}
+
+func (writerSink) Close() error {
+	return nil
+}
+
+// unixSockSink talks to the collectd unixsock plugin, which replies to each
+// command with a status line: "0 Success..." or "-1 <error>".
+type unixSockSink struct {
+	conn    net.Conn
+	replies *bufio.Reader
+}
+
+func dialUnixSock(path string) (*unixSockSink, error) {
+	conn, err := net.DialTimeout("unix", path, sinkTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return &unixSockSink{
+		conn:    conn,
+		replies: bufio.NewReader(conn),
+	}, nil
+}
+
+func (us *unixSockSink) Send(line string) error {
+	err := us.conn.SetDeadline(time.Now().Add(sinkTimeout))
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(us.conn, line+"\n")
+	if err != nil {
+		return err
+	}
+	reply, err := us.replies.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	// collectd got the line, resending it would be rejected again
+	if strings.HasPrefix(reply, "-") {
+		throttled.Warning("line rejected by collectd", "line", line, "reply", strings.TrimSpace(reply))
+	}
+	return nil
+}
+
+func (us *unixSockSink) Close() error {
+	return us.conn.Close()
+}
@@ -0,0 +1,184 @@
+package procnotify
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ProcStatus describes a tracked process.
+type ProcStatus struct {
+	Pid int32 `json:"pid"`
+	// Parent is the matched process this one descends from, if any
+	Parent int32  `json:"parent,omitempty"`
+	Comm   string `json:"comm,omitempty"`
+	Pod    string `json:"pod,omitempty"`
+	// Samples are the last values collected for the process
+	Samples []Sample `json:"samples"`
+}
+
+// TargetStatus describes a target and the processes tracked for it.
+type TargetStatus struct {
+	Config   Config       `json:"config"`
+	Pids     []int32      `json:"pids"`
+	Procs    []ProcStatus `json:"procs"`
+	Restarts uint64       `json:"restarts"`
+	Down     bool         `json:"down"`
+}
+
+// SinkStatus describes how the output is doing.
+type SinkStatus struct {
+	// Path is the unix socket the output is sent to, empty for stdout
+	Path      string    `json:"path"`
+	LastFlush time.Time `json:"last_flush"`
+	// LastError is the error of the last flush, empty if it succeeded
+	LastError string `json:"last_error,omitempty"`
+	// LastSuccess is the last time the sink accepted data
+	LastSuccess time.Time `json:"last_success"`
+	// Samples is the number of samples the sink accepted so far
+	Samples uint64 `json:"samples"`
+	Errors  uint64 `json:"errors"`
+	Pending int    `json:"pending"`
+	Dropped uint64 `json:"dropped"`
+}
+
+// Status is a snapshot of the state of the Notifier.
+type Status struct {
+	LastScan time.Time      `json:"last_scan"`
+	Stats    Stats          `json:"stats"`
+	Sink     SinkStatus     `json:"sink"`
+	Targets  []TargetStatus `json:"targets"`
+}
+
+// sinkState has its own lock, so the health checks don't wait
+// for a collection in progress.
+type sinkState struct {
+	lock        sync.Mutex
+	lastFlush   time.Time
+	lastSuccess time.Time
+	lastErr     error
+	samples     uint64
+	errors      uint64
+}
+
+func (notif *Notifier) flushDone(now time.Time, samples int, err error) {
+	notif.sink.lock.Lock()
+	defer notif.sink.lock.Unlock()
+	notif.sink.lastFlush = now
+	notif.sink.lastErr = err
+	if err == nil {
+		notif.sink.samples += uint64(samples)
+		notif.sink.lastSuccess = now
+	} else {
+		notif.sink.errors++
+	}
+}
+
+// recordLast keeps the last samples of each process, for the status.
+func (notif *Notifier) recordLast(items []Sample) {
+	last := make(map[int32][]Sample)
+	for _, item := range items {
+		if item.Pid == 0 {
+			continue
+		}
+		if _, ok := notif.procs[item.Pid]; !ok {
+			continue
+		}
+		last[item.Pid] = append(last[item.Pid], item)
+	}
+	// targets not due in this tick keep their previous samples
+	for pid, prev := range notif.last {
+		if _, ok := last[pid]; ok {
+			continue
+		}
+		if _, ok := notif.procs[pid]; ok {
+			last[pid] = prev
+		}
+	}
+	notif.last = last
+}
+
+func (notif *Notifier) sinkStatus() SinkStatus {
+	notif.sink.lock.Lock()
+	defer notif.sink.lock.Unlock()
+	st := SinkStatus{
+		Path:        notif.sinkPath,
+		LastFlush:   notif.sink.lastFlush,
+		LastSuccess: notif.sink.lastSuccess,
+		Samples:     notif.sink.samples,
+		Errors:      notif.sink.errors,
+	}
+	if notif.sink.lastErr != nil {
+		st.LastError = notif.sink.lastErr.Error()
+	}
+	if notif.Queue != nil {
+		st.Pending = notif.Queue.Len()
+		st.Dropped = notif.Queue.Dropped()
+	}
+	return st
+}
+
+// Status returns a snapshot of the targets, the tracked processes
+// and the health of the collection.
+func (notif *Notifier) Status() Status {
+	notif.lock.Lock()
+	defer notif.lock.Unlock()
+
+	st := Status{
+		LastScan: notif.lastScan,
+		Stats:    notif.Stats(),
+		Sink:     notif.sinkStatus(),
+	}
+	for _, target := range notif.targets {
+		ts := TargetStatus{
+			Config:   target.Config,
+			Pids:     []int32{},
+			Procs:    []ProcStatus{},
+			Restarts: target.restarts,
+			Down:     target.down,
+		}
+		for _, pid := range target.Pids {
+			ts.Pids = append(ts.Pids, int32(pid))
+		}
+		for pid, proc := range notif.procs {
+			if proc.t != target {
+				continue
+			}
+			ps := ProcStatus{
+				Pid:     pid,
+				Parent:  proc.parent,
+				Comm:    proc.comm,
+				Samples: notif.last[pid],
+			}
+			if notif.pr != nil && proc.parent == 0 {
+				ps.Pod, _ = notif.pr.FindPodByPID(pid)
+			}
+			ts.Procs = append(ts.Procs, ps)
+		}
+		sort.Slice(ts.Procs, func(i, j int) bool {
+			return ts.Procs[i].Pid < ts.Procs[j].Pid
+		})
+		st.Targets = append(st.Targets, ts)
+	}
+	return st
+}
+
+// Rescan looks again for the processes of the targets, as soon as
+// the collection in progress, if any, is done.
+func (notif *Notifier) Rescan() error {
+	notif.lock.Lock()
+	defer notif.lock.Unlock()
+	return notif.Scan()
+}
+
+// RefreshPods updates the pod cache, without waiting for the
+// collection in progress, if any.
+func (notif *Notifier) RefreshPods() error {
+	if notif.pr == nil {
+		return ErrNoPodResolver
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), refreshPodsTimeout)
+	defer cancel()
+	return notif.updatePods(ctx)
+}
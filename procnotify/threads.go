@@ -0,0 +1,100 @@
+package procnotify
+
+import (
+	"github.com/fromanirh/procwatch/procfs"
+
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Thread breakdown modes
+const (
+	// ThreadBreakdownThread reports each thread on its own
+	ThreadBreakdownThread = "thread"
+	// ThreadBreakdownComm reports threads grouped by their name (comm)
+	ThreadBreakdownComm = "comm"
+)
+
+type threadStats struct {
+	count     int
+	utime     uint64
+	stime     uint64
+	schedstat bool
+	runTime   uint64
+	waitTime  uint64
+	processor int64
+}
+
+// instanceName makes the given string usable as collectd type instance:
+// "CPU 0/KVM" becomes "CPU_0_KVM"
+func instanceName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' || r == '.' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+func collectThreadBreakdown(notif *Notifier, proc Proc, s *samples) error {
+	pid := proc.p.Pid
+	tids, err := procfs.Tasks(pid)
+	if err != nil {
+		return err
+	}
+
+	groups := make(map[string]*threadStats)
+	for _, tid := range tids {
+		st, err := procfs.ReadTaskStat(pid, tid)
+		if err != nil {
+			// thread gone meanwhile
+			continue
+		}
+		key := instanceName(st.Comm)
+		if proc.t.ThreadBreakdown == ThreadBreakdownThread {
+			key = fmt.Sprintf("%s_%d", key, tid)
+		}
+		ts, ok := groups[key]
+		if !ok {
+			ts = &threadStats{schedstat: true}
+			groups[key] = ts
+		}
+		ts.count++
+		ts.utime += st.UTime
+		ts.stime += st.STime
+		ts.processor = st.Processor
+
+		ss, err := procfs.ReadTaskSchedstat(pid, tid)
+		if err != nil {
+			// kernel built without schedstats
+			ts.schedstat = false
+			continue
+		}
+		ts.runTime += ss.RunTime
+		ts.waitTime += ss.WaitTime
+	}
+
+	keys := make([]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		ts := groups[key]
+		s.add(fmt.Sprintf("cpu-thread_%s_user", key), float64(ts.utime))
+		s.add(fmt.Sprintf("cpu-thread_%s_system", key), float64(ts.stime))
+		if ts.schedstat {
+			// nanoseconds spent running and waiting on the run queue
+			s.add(fmt.Sprintf("derive-thread_%s_run", key), float64(ts.runTime))
+			s.add(fmt.Sprintf("derive-thread_%s_wait", key), float64(ts.waitTime))
+		}
+		if proc.t.ThreadBreakdown == ThreadBreakdownThread {
+			s.add(fmt.Sprintf("gauge-thread_%s_last_cpu", key), float64(ts.processor))
+		} else {
+			s.add(fmt.Sprintf("threads-%s", key), float64(ts.count))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package procnotify
+
+import (
+	"github.com/fromanirh/procwatch/procfs/procfstest"
+	"github.com/shirou/gopsutil/process"
+
+	"testing"
+)
+
+func TestInstanceName(t *testing.T) {
+	testcases := map[string]string{
+		"CPU 0/KVM":    "CPU_0_KVM",
+		"IO iothread1": "IO_iothread1",
+		"qemu-kvm":     "qemu_kvm",
+		"vdsm.main":    "vdsm.main",
+	}
+	for name, expected := range testcases {
+		if got := instanceName(name); got != expected {
+			t.Errorf("mismatch: got %q expected %q", got, expected)
+		}
+	}
+}
+
+func TestCollectThreadBreakdown(t *testing.T) {
+	fs := procfstest.New(t)
+	defer fs.Remove()
+	defer fs.Use()()
+	fs.Add(procfstest.Proc{
+		Pid:   2192,
+		PPid:  1,
+		Argv:  []string{"/usr/libexec/qemu-kvm"},
+		UTime: 100,
+		STime: 10,
+		Tasks: []procfstest.Task{
+			{Tid: 2193, Comm: "CPU 0/KVM", UTime: 500, STime: 50, Processor: 1},
+			{Tid: 2194, Comm: "worker", UTime: 20, STime: 2, Processor: 3},
+			{Tid: 2195, Comm: "worker", UTime: 30, STime: 3, Processor: 2},
+		},
+	})
+
+	testcases := []struct {
+		mode     string
+		expected map[string]float64
+	}{
+		{
+			mode: ThreadBreakdownThread,
+			expected: map[string]float64{
+				"cpu-thread_qemu_kvm_2192_user":        100,
+				"cpu-thread_CPU_0_KVM_2193_user":       500,
+				"cpu-thread_CPU_0_KVM_2193_system":     50,
+				"derive-thread_CPU_0_KVM_2193_run":     5500000000,
+				"gauge-thread_CPU_0_KVM_2193_last_cpu": 1,
+				"cpu-thread_worker_2194_user":          20,
+				"gauge-thread_worker_2195_last_cpu":    2,
+			},
+		},
+		{
+			mode: ThreadBreakdownComm,
+			expected: map[string]float64{
+				"cpu-thread_qemu_kvm_user":  100,
+				"threads-qemu_kvm":          1,
+				"cpu-thread_CPU_0_KVM_user": 500,
+				"threads-CPU_0_KVM":         1,
+				"cpu-thread_worker_user":    50,
+				"cpu-thread_worker_system":  5,
+				"derive-thread_worker_run":  550000000,
+				"threads-worker":            2,
+			},
+		},
+	}
+	for _, tc := range testcases {
+		target := &Target{Config: Config{Name: "qemu", ThreadBreakdown: tc.mode}}
+		proc := Proc{t: target, p: &process.Process{Pid: 2192}}
+		s := &samples{}
+		err := collectThreadBreakdown(nil, proc, s)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		got := make(map[string]float64)
+		for _, item := range s.items {
+			got[item.Name] = item.Value
+		}
+		for name, value := range tc.expected {
+			if v, ok := got[name]; !ok || v != value {
+				t.Errorf("%s: mismatch for %s: got %v expected %v", tc.mode, name, v, value)
+			}
+		}
+		if tc.mode == ThreadBreakdownComm && len(got) != 3*5 {
+			t.Errorf("%s: unexpected series: %v", tc.mode, got)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package procnotify
+
+import (
+	"github.com/fromanirh/procwatch/procfs"
+	"github.com/shirou/gopsutil/process"
+)
+
+// summedMetrics are the metrics of the descendants added to the ones of
+// their ancestor, for the targets which ask so.
+var summedMetrics = map[string]bool{
+	"cpu-perc":               true,
+	"percent-cpu":            true,
+	"percent-cpu_normalized": true,
+	"memory-virtual":         true,
+	"memory-resident":        true,
+	"memory-proportional":    true,
+	"memory-swap":            true,
+	"file_handles-open":      true,
+	"threads":                true,
+}
+
+func (t *Target) tracksDescendants() bool {
+	return t.IncludeChildren || t.IncludeDescendants
+}
+
+// trackDescendants refreshes the children (or all the descendants) of the
+// matched processes, for the targets which asked for them.
+// Descendants are attributed to the target of their ancestor.
+func (notif *Notifier) trackDescendants() error {
+	wanted := false
+	for _, target := range notif.targets {
+		wanted = wanted || target.tracksDescendants()
+	}
+	if !wanted {
+		return nil
+	}
+
+	tree, err := procfs.ReadTree()
+	if err != nil {
+		return err
+	}
+
+	alive := make(map[int32]bool)
+	added := make(map[int32]Proc)
+	for pid, proc := range notif.procs {
+		if proc.parent != 0 || !proc.t.tracksDescendants() {
+			continue
+		}
+		descs := tree.Children(pid)
+		if proc.t.IncludeDescendants {
+			descs = tree.Descendants(pid)
+		}
+		for _, desc := range descs {
+			alive[desc] = true
+			if _, ok := notif.procs[desc]; ok {
+				continue
+			}
+			p, err := process.NewProcess(desc)
+			if err != nil {
+				continue
+			}
+			st, err := procfs.ReadStat(desc)
+			if err != nil {
+				continue
+			}
+			logger.Debug("new descendant PID", "target", proc.t.Name, "pid", desc, "comm", st.Comm, "parent", pid)
+			added[desc] = Proc{t: proc.t, p: p, parent: pid, comm: instanceName(st.Comm)}
+		}
+	}
+
+	for pid, proc := range notif.procs {
+		if proc.parent != 0 && !alive[pid] {
+			delete(notif.procs, pid)
+		}
+	}
+	for pid, proc := range added {
+		notif.procs[pid] = proc
+	}
+	return nil
+}
+
+// sumDescendants adds the summable metrics of the descendants to the ones of
+// the process they descend from, and drops their own samples, for the
+// targets which ask so.
+func (notif *Notifier) sumDescendants(items []Sample) []Sample {
+	summing := make(map[string]bool)
+	for _, target := range notif.targets {
+		if target.SumChildren && target.tracksDescendants() {
+			summing[target.Name] = true
+		}
+	}
+	if len(summing) == 0 {
+		return items
+	}
+
+	type key struct {
+		pid  int32
+		name string
+	}
+	var kept []Sample
+	index := make(map[key]int)
+	for _, item := range items {
+		if item.Parent != 0 && summing[item.Target] {
+			continue
+		}
+		index[key{pid: item.Pid, name: item.Name}] = len(kept)
+		kept = append(kept, item)
+	}
+	for _, item := range items {
+		if item.Parent == 0 || !summing[item.Target] || !summedMetrics[item.Name] {
+			continue
+		}
+		idx, ok := index[key{pid: item.Parent, name: item.Name}]
+		if !ok {
+			continue
+		}
+		kept[idx].Value += item.Value
+	}
+	return kept
+}
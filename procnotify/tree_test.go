@@ -0,0 +1,32 @@
+package procnotify
+
+import (
+	"testing"
+)
+
+func TestSumDescendants(t *testing.T) {
+	notif := NewNotifier([]Config{
+		{Name: "vdsm", Argv: []string{"vdsm"}, IncludeDescendants: true, SumChildren: true},
+		{Name: "libvirtd", Argv: []string{"libvirtd"}, IncludeChildren: true},
+	}, nil, "")
+
+	items := []Sample{
+		{Target: "vdsm", Pid: 10, Name: "memory-resident", Value: 1024},
+		{Target: "vdsm", Pid: 10, Name: "cpu-user", Value: 100},
+		{Target: "vdsm", Pid: 11, Parent: 10, Name: "memory-resident", Value: 512},
+		{Target: "vdsm", Pid: 11, Parent: 10, Name: "cpu-user", Value: 7},
+		{Target: "vdsm", Pid: 12, Parent: 10, Name: "memory-resident", Value: 256},
+		{Target: "libvirtd", Pid: 20, Name: "memory-resident", Value: 2048},
+		{Target: "libvirtd", Pid: 21, Parent: 20, Name: "memory-resident", Value: 128},
+	}
+	got := notif.sumDescendants(items)
+	if len(got) != 4 {
+		t.Fatalf("unexpected samples: %v", got)
+	}
+	expected := []float64{1024 + 512 + 256, 100, 2048, 128}
+	for idx, item := range got {
+		if item.Value != expected[idx] {
+			t.Errorf("mismatch for %v: expected %v", item, expected[idx])
+		}
+	}
+}
@@ -0,0 +1,301 @@
+// Package procrec records the parts of /proc (and of the cgroup filesystem)
+// procwatch reads into an archive, and plays them back.
+package procrec
+
+import (
+	"github.com/fromanirh/procwatch/cgroups"
+	"github.com/fromanirh/procwatch/podfind"
+	"github.com/fromanirh/procwatch/procfs"
+
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrMalformedArchive = errors.New("malformed archive")
+)
+
+const (
+	metaName  = "meta.json"
+	procDir   = "proc"
+	cgroupDir = "sys/fs/cgroup"
+)
+
+// rootFiles are the system wide files procwatch reads.
+var rootFiles = []string{"stat", "cpuinfo"}
+
+// scanFiles are recorded for every process, to replay the matching
+// and the process tree.
+var scanFiles = []string{"cmdline", "stat"}
+
+// pidFiles are recorded for the processes procwatch tracks.
+var pidFiles = []string{"comm", "status", "statm", "io", "cgroup", "limits", "schedstat", "smaps"}
+
+// taskFiles are recorded for each thread of the processes procwatch tracks.
+var taskFiles = []string{"comm", "stat", "schedstat"}
+
+// cgroupControllers are the v1 controllers whose accounting is recorded.
+var cgroupControllers = []string{"cpu", "cpuacct", "memory", "blkio"}
+
+// Meta describes a snapshot.
+type Meta struct {
+	Time     time.Time     `json:"time"`
+	Hostname string        `json:"hostname"`
+	Interval time.Duration `json:"interval"`
+	// Pods is the CRI listing, if pod resolution was enabled
+	Pods *podfind.Listing `json:"pods,omitempty"`
+}
+
+// Writer adds snapshots to an archive: a gzipped tarball with a directory
+// per snapshot, which mirrors the layout of the filesystems.
+type Writer struct {
+	gz  *gzip.Writer
+	tw  *tar.Writer
+	seq int
+}
+
+func NewWriter(w io.Writer) *Writer {
+	gz := gzip.NewWriter(w)
+	return &Writer{
+		gz: gz,
+		tw: tar.NewWriter(gz),
+	}
+}
+
+// AddFile adds a file to the archive, outside of any snapshot.
+func (w *Writer) AddFile(name string, data []byte) error {
+	err := w.tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = w.tw.Write(data)
+	return err
+}
+
+// copyFile adds to the snapshot the file at src. Files which vanished
+// or can't be read, like the ones of the processes gone meanwhile,
+// are skipped.
+func (w *Writer) copyFile(src, dst string) error {
+	info, err := os.Stat(src)
+	if err != nil || !info.Mode().IsRegular() {
+		return nil
+	}
+	// proc files report a zero size, so read them whole: the smaps of
+	// the big processes, like qemu, are several MiBs
+	data, err := ioutil.ReadFile(src)
+	if err != nil {
+		return nil
+	}
+	return w.AddFile(dst, data)
+}
+
+// Snapshot records the files of the given processes, the files of all
+// the processes needed to find them, and the pod listing.
+func (w *Writer) Snapshot(meta Meta, pids []int32) error {
+	dir := fmt.Sprintf("%06d", w.seq)
+	w.seq++
+
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	err = w.AddFile(filepath.Join(dir, metaName), data)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range rootFiles {
+		err = w.copyFile(filepath.Join(procfs.Root, name), filepath.Join(dir, procDir, name))
+		if err != nil {
+			return err
+		}
+	}
+
+	// tells cgroups which layout the host has
+	err = w.copyFile(filepath.Join(cgroups.Root, "cgroup.controllers"), filepath.Join(dir, cgroupDir, "cgroup.controllers"))
+	if err != nil {
+		return err
+	}
+
+	entries, err := filepath.Glob(filepath.Join(procfs.Root, "[0-9]*"))
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		for _, name := range scanFiles {
+			err = w.copyFile(filepath.Join(entry, name), filepath.Join(dir, procDir, filepath.Base(entry), name))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, pid := range pids {
+		err = w.snapshotPid(dir, pid)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *Writer) snapshotPid(dir string, pid int32) error {
+	pidDir := filepath.Join(dir, procDir, strconv.Itoa(int(pid)))
+	for _, name := range pidFiles {
+		err := w.copyFile(procfs.PidPath(pid, name), filepath.Join(pidDir, name))
+		if err != nil {
+			return err
+		}
+	}
+
+	// only the number of the file descriptors matters
+	fds, _ := filepath.Glob(procfs.PidPath(pid, "fd", "*"))
+	for _, fd := range fds {
+		err := w.AddFile(filepath.Join(pidDir, "fd", filepath.Base(fd)), nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	tids, _ := procfs.Tasks(pid)
+	for _, tid := range tids {
+		for _, name := range taskFiles {
+			tidName := strconv.Itoa(int(tid))
+			err := w.copyFile(procfs.PidPath(pid, "task", tidName, name), filepath.Join(pidDir, "task", tidName, name))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	entries, err := cgroups.ReadProcCGroups(pid)
+	if err != nil {
+		return nil
+	}
+	var dirs []string
+	if d, err := cgroups.UnifiedDir(entries); err == nil {
+		dirs = append(dirs, d)
+	}
+	for _, controller := range cgroupControllers {
+		if d, err := cgroups.ControllerDir(entries, controller); err == nil {
+			dirs = append(dirs, d)
+		}
+	}
+	for _, d := range dirs {
+		rel, err := filepath.Rel(cgroups.Root, d)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		files, _ := filepath.Glob(filepath.Join(d, "*"))
+		for _, file := range files {
+			err = w.copyFile(file, filepath.Join(dir, cgroupDir, rel, filepath.Base(file)))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (w *Writer) Close() error {
+	err := w.tw.Close()
+	if err != nil {
+		w.gz.Close()
+		return err
+	}
+	return w.gz.Close()
+}
+
+// Snapshot is a recorded state of the system.
+type Snapshot struct {
+	Meta
+	// Dir is where the snapshot was extracted
+	Dir string
+}
+
+// Use points procfs, cgroups and gopsutil to the snapshot. The returned
+// function restores the previous settings.
+func (s Snapshot) Use() func() {
+	cgroupRoot := cgroups.Root
+	restore := procfs.SetRoot(filepath.Join(s.Dir, procDir))
+	cgroups.Root = filepath.Join(s.Dir, cgroupDir)
+
+	return func() {
+		cgroups.Root = cgroupRoot
+		restore()
+	}
+}
+
+// Extract unpacks the archive into dir, and returns its snapshots, in order.
+func Extract(r io.Reader, dir string) ([]Snapshot, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		name := filepath.Clean(hdr.Name)
+		if filepath.IsAbs(name) || strings.HasPrefix(name, "..") {
+			return nil, ErrMalformedArchive
+		}
+		path := filepath.Join(dir, name)
+		err = os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			return nil, err
+		}
+		f, err := os.Create(path)
+		if err != nil {
+			return nil, err
+		}
+		_, err = io.Copy(f, tr)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	metas, err := filepath.Glob(filepath.Join(dir, "[0-9]*", metaName))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(metas)
+	var snaps []Snapshot
+	for _, path := range metas {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		snap := Snapshot{Dir: filepath.Dir(path)}
+		err = json.Unmarshal(data, &snap.Meta)
+		if err != nil {
+			return nil, ErrMalformedArchive
+		}
+		snaps = append(snaps, snap)
+	}
+	return snaps, nil
+}
@@ -0,0 +1,151 @@
+package procrec
+
+import (
+	"github.com/fromanirh/procwatch/cgroups"
+	"github.com/fromanirh/procwatch/podfind"
+	"github.com/fromanirh/procwatch/procfs"
+	"github.com/fromanirh/procwatch/procfs/procfstest"
+
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRecordExtract(t *testing.T) {
+	fs := procfstest.New(t)
+	defer fs.Remove()
+	restoreRoot := fs.Use()
+	oldRoot := cgroups.Root
+	cgroups.Root = filepath.Join(fs.Root, "cgroup")
+	defer func() { cgroups.Root = oldRoot }()
+	pid := int32(2192)
+	fs.Add(procfstest.Proc{Pid: pid, PPid: 1, Argv: []string{"/usr/libexec/qemu-kvm"}, FDs: 3})
+	meta := Meta{
+		Time:     time.Date(2018, 11, 20, 10, 0, 0, 0, time.UTC),
+		Hostname: "node0",
+		Interval: 5 * time.Second,
+		Pods: &podfind.Listing{
+			Containers: map[string]string{"c0": "p0"},
+			Pods:       map[string]string{"p0": "virt-launcher"},
+		},
+	}
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	err := w.AddFile("config.json", []byte("{}"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for i := 0; i < 2; i++ {
+		err = w.Snapshot(meta, []int32{pid})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		meta.Time = meta.Time.Add(meta.Interval)
+	}
+	err = w.Close()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// replayed from the archive only
+	restoreRoot()
+	fs.Remove()
+
+	dir, err := ioutil.TempDir("", "procrec")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	snaps, err := Extract(&buf, dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(snaps) != 2 {
+		t.Fatalf("expected 2 snapshots, got %d", len(snaps))
+	}
+	if !snaps[1].Time.Equal(meta.Time.Add(-meta.Interval)) || snaps[1].Hostname != "node0" {
+		t.Errorf("mismatch: %#v", snaps[1].Meta)
+	}
+	if snaps[0].Pods == nil || snaps[0].Pods.Pods["p0"] != "virt-launcher" {
+		t.Errorf("pod listing not recorded: %#v", snaps[0].Pods)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "config.json")); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	restore := snaps[0].Use()
+	st, err := procfs.ReadStat(pid)
+	restore()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if st.Pid != pid {
+		t.Errorf("mismatch: got pid %d expected %d", st.Pid, pid)
+	}
+	fds, _ := filepath.Glob(filepath.Join(snaps[0].Dir, "proc", strconv.Itoa(int(pid)), "fd", "*"))
+	if len(fds) == 0 {
+		t.Errorf("file descriptors not recorded")
+	}
+}
+
+func TestExtractMalformed(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	err := w.AddFile("../escape", []byte("x"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	w.Close()
+
+	dir, err := ioutil.TempDir("", "procrec")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	_, err = Extract(&buf, dir)
+	if err != ErrMalformedArchive {
+		t.Errorf("expected %v, got %v", ErrMalformedArchive, err)
+	}
+}
+
+func TestRecordLargeFile(t *testing.T) {
+	fs := procfstest.New(t)
+	defer fs.Remove()
+	defer fs.Use()()
+	fs.Add(procfstest.Proc{Pid: 2192, PPid: 1, Argv: []string{"/usr/libexec/qemu-kvm"}})
+	// the smaps of a big qemu
+	smaps := bytes.Repeat([]byte("Pss:                   4 kB\n"), 200000)
+	err := ioutil.WriteFile(filepath.Join(fs.Root, "2192", "smaps"), smaps, 0644)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	err = w.Snapshot(Meta{Hostname: "node0"}, []int32{2192})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	w.Close()
+
+	dir, err := ioutil.TempDir("", "procrec")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	snaps, err := Extract(&buf, dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(snaps[0].Dir, "proc", "2192", "smaps"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !bytes.Equal(data, smaps) {
+		t.Errorf("mismatch: %d bytes recorded, expected %d", len(data), len(smaps))
+	}
+}
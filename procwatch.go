@@ -3,6 +3,8 @@ package main
 import (
 	"github.com/davecgh/go-spew/spew"
 	"github.com/fromanirh/procwatch/podfind"
+	"github.com/fromanirh/procwatch/procapi"
+	"github.com/fromanirh/procwatch/proclog"
 	"github.com/fromanirh/procwatch/procnotify"
 	flag "github.com/spf13/pflag"
 
@@ -10,7 +12,6 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"os"
 	"strconv"
 	"time"
@@ -18,6 +19,8 @@ import (
 
 const confFile string = "procwatch.json"
 
+var logger = proclog.New("procwatch")
+
 type Config struct {
 	Targets     []procnotify.Config `json:"targets"`
 	Interval    string              `json:"interval"`
@@ -25,6 +28,16 @@ type Config struct {
 	CRIEndPoint string              `json:"criendpoint"`
 	AutoTrack   bool                `json:"autotrack"`
 	DebugMode   bool                `json:"debugmode"`
+	Workers     int                 `json:"workers"`
+	Deadline    string              `json:"deadline"`
+	Webhook     string              `json:"webhook"`
+	SelfMetrics bool                `json:"selfmetrics"`
+	// HistorySize is the number of samples kept per series; negative disables the history
+	HistorySize int    `json:"historysize"`
+	HistoryPath string `json:"historypath"`
+	// Queue enables the buffering of the output while the sink is unavailable
+	Queue *procnotify.QueueConfig `json:"queue"`
+	Log   proclog.Config          `json:"log"`
 }
 
 func (c Config) CountTargets() int {
@@ -32,7 +45,7 @@ func (c Config) CountTargets() int {
 }
 
 func readFile(conf *Config, path string) error {
-	log.Printf("trying configuration: %s", path)
+	logger.Debug("trying configuration", "path", path)
 
 	content, err := ioutil.ReadFile(path)
 	if err != nil {
@@ -46,10 +59,34 @@ func readFile(conf *Config, path string) error {
 		}
 	}
 
-	log.Printf("Read from file: %s", path)
+	logger.Info("configuration read", "path", path)
 	return nil
 }
 
+// setupLog configures the logging from the configuration, overridden
+// by the flags.
+func setupLog(conf Config, debug bool, levels, format string) error {
+	lc := conf.Log
+	lc.Subsystems = make(map[string]string)
+	for name, level := range conf.Log.Subsystems {
+		lc.Subsystems[name] = level
+	}
+	if debug || conf.DebugMode {
+		lc.Level = proclog.LevelDebug.String()
+		lc.Subsystems = make(map[string]string)
+	}
+	if levels != "" {
+		err := lc.ParseLevels(levels)
+		if err != nil {
+			return err
+		}
+	}
+	if format != "" {
+		lc.Format = format
+	}
+	return proclog.Setup(lc, os.Stderr)
+}
+
 func findInterval(conf Config, args []string) (time.Duration, error) {
 	if len(args) >= 2 {
 		ival, err := strconv.Atoi(args[1])
@@ -69,7 +106,7 @@ func findInterval(conf Config, args []string) (time.Duration, error) {
 	}
 
 	if conf.Interval == "" {
-		return 0, errors.New(fmt.Sprintf("invalid interval: %d", conf.Interval))
+		return 0, errors.New(fmt.Sprintf("invalid interval: %q", conf.Interval))
 	}
 
 	dval, err := time.ParseDuration(conf.Interval)
@@ -80,13 +117,36 @@ func findInterval(conf Config, args []string) (time.Duration, error) {
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "query":
+			os.Exit(runQuery(os.Args[2:]))
+		case "list":
+			os.Exit(runList(os.Args[2:]))
+		case "top":
+			os.Exit(runTop(os.Args[2:]))
+		case "record":
+			os.Exit(runRecord(os.Args[2:]))
+		case "replay":
+			os.Exit(runReplay(os.Args[2:]))
+		}
+	}
+
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "usage: %s /path/to/procwatch.json [interval_seconds]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s query [options]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s list [options] /path/to/procwatch.json\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s top [options] /path/to/procwatch.json\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s record [options] /path/to/procwatch.json\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s replay [options] /path/to/archive.tar.gz\n", os.Args[0])
 		flag.PrintDefaults()
 	}
 	requirePodResolution := flag.BoolP("require-pod", "R", false, "fail if pod resolution is not enabled")
-	debugMode := flag.BoolP("debug", "D", false, "enable pod resolution debug mode")
+	debugMode := flag.BoolP("debug", "D", false, "log at the debug level, like debugmode in the configuration")
+	logLevels := flag.String("log-level", "", "log at <level>, and per subsystem like \"info,podfind=debug\"")
+	logFormat := flag.String("log-format", "", "log as \"text\" or \"json\"")
 	sinkPath := flag.StringP("unixsock", "U", "", "send output to <unixsock> not to stdout")
+	apiAddr := flag.StringP("api", "A", "", "serve the HTTP API on <host:port> or <unix:/path>")
 	flag.Parse()
 
 	args := flag.Args()
@@ -96,61 +156,118 @@ func main() {
 		return
 	}
 
-	log.Printf("procwatcher started")
-	defer log.Printf("procwatcher stopped")
-
+	// the flags apply to the records logged while reading the configuration too
 	conf := Config{Interval: "5s"}
-	err := readFile(&conf, args[0])
+	err := setupLog(conf, *debugMode, *logLevels, *logFormat)
 	if err != nil {
-		log.Fatalf("error reading the configuration on '%s': %s", args[0], err)
+		fmt.Fprintf(os.Stderr, "invalid logging settings: %s\n", err)
+		os.Exit(2)
+	}
+
+	logger.Info("procwatcher started")
+	defer logger.Info("procwatcher stopped")
+
+	err = readFile(&conf, args[0])
+	if err != nil {
+		logger.Fatal("cannot read the configuration", "path", args[0], "error", err)
+	}
+	err = setupLog(conf, *debugMode, *logLevels, *logFormat)
+	if err != nil {
+		logger.Fatal("invalid logging settings", "error", err)
 	}
 
 	conf.Hostname = os.Getenv("COLLECTD_HOSTNAME")
 	if conf.Hostname == "" {
 		conf.Hostname, err = os.Hostname()
 		if err != nil {
-			log.Fatalf("error getting the host name: %s", err)
+			logger.Fatal("cannot get the host name", "error", err)
 		}
 	}
 
 	interval, err := findInterval(conf, args)
 	if err != nil {
-		log.Fatalf("error getting the polling interval: %s", err)
+		logger.Fatal("cannot get the polling interval", "error", err)
 	} else {
-		log.Printf("polling interval: %v", interval)
+		logger.Info("polling interval", "interval", interval)
 	}
 
 	dryRun := os.Getenv("PROCWATCH_DRYRUN")
 	if dryRun != "" {
-		log.Printf("%s", spew.Sdump(conf))
+		fmt.Fprint(os.Stderr, spew.Sdump(conf))
 		return
 	}
 
 	if conf.CountTargets() == 0 {
-		log.Fatalf("missing process(es) to track")
+		logger.Fatal("missing process(es) to track")
+	}
+	for _, target := range conf.Targets {
+		err = target.Validate()
+		if err != nil {
+			logger.Fatal("invalid target configuration", "target", target.Name, "error", err)
+		}
+	}
+	if conf.Queue != nil {
+		err = conf.Queue.Validate()
+		if err != nil {
+			logger.Fatal("invalid queue configuration", "error", err)
+		}
 	}
 
 	var pr *podfind.PodResolver
 	if conf.CRIEndPoint != "" {
-		log.Printf("enabled POD ID resolution")
+		logger.Info("enabled POD ID resolution", "endpoint", conf.CRIEndPoint)
 		pr, err = podfind.NewPodResolver(conf.CRIEndPoint, 10*time.Second)
 		if err != nil {
-			log.Printf("unable to set up pod resolution: %s", err)
+			logger.Error("cannot set up the pod resolution", "error", err)
 			pr = nil
-		} else {
-			pr.Debug = *debugMode
 		}
 	}
 
 	if pr == nil && *requirePodResolution {
-		log.Fatalf("pod resolution required but not enabled!")
+		logger.Fatal("pod resolution required but not enabled")
 	}
 
 	notifier := procnotify.NewNotifier(conf.Targets, pr, *sinkPath)
-	notifier.Debug = conf.DebugMode
-	log.Printf("Tracking:\n")
+	notifier.Workers = conf.Workers
+	notifier.Webhook = conf.Webhook
+	notifier.RequirePods = *requirePodResolution
+	notifier.SelfMetrics = conf.SelfMetrics
+	if conf.Deadline != "" {
+		notifier.Deadline, err = time.ParseDuration(conf.Deadline)
+		if err != nil {
+			logger.Fatal("cannot parse the collection deadline", "error", err)
+		}
+	}
+	if conf.HistorySize >= 0 {
+		notifier.History = procnotify.NewHistory(conf.HistorySize)
+		notifier.History.Path = conf.HistoryPath
+		err = notifier.History.Load()
+		if err != nil {
+			logger.Warning("cannot load the history", "path", conf.HistoryPath, "error", err)
+		}
+	}
+	if conf.Queue != nil {
+		notifier.Queue, err = procnotify.NewQueue(*conf.Queue)
+		if err != nil {
+			logger.Fatal("cannot set up the output queue", "error", err)
+		}
+		logger.Info("output queue enabled", "pending", notifier.Queue.Len())
+	}
+	logger.Info("tracking", "targets", len(conf.Targets))
 	notifier.Dump(os.Stderr)
 
+	if *apiAddr != "" {
+		srv := procapi.NewServer(notifier)
+		srv.Config = conf
+		go func() {
+			logger.Info("serving the API", "address", *apiAddr)
+			err := srv.ListenAndServe(*apiAddr)
+			if err != nil {
+				logger.Error("API server failed", "error", err)
+			}
+		}()
+	}
+
 	if interval == 0 {
 		notifier.Once(conf.Hostname)
 	} else {
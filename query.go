@@ -0,0 +1,107 @@
+package main
+
+import (
+	"github.com/fromanirh/procwatch/procapi"
+	"github.com/fromanirh/procwatch/procnotify"
+	flag "github.com/spf13/pflag"
+
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// defaultQuerySince bounds the queries to a running procwatch.
+const defaultQuerySince = "1h"
+
+// runQuery implements the query subcommand: fetch samples from the history
+// of a running procwatch, or from a saved history file.
+func runQuery(args []string) int {
+	fs := flag.NewFlagSet("query", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s query [options]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	apiAddr := fs.StringP("api", "A", "", "query the procwatch API on <host:port> or <unix:/path>")
+	histFile := fs.StringP("file", "f", "", "query the history saved in <file>")
+	target := fs.StringP("target", "t", "", "only samples of <target>")
+	pid := fs.IntP("pid", "p", 0, "only samples of <pid>")
+	metric := fs.StringP("metric", "m", "", "only samples of <metric>, either type-instance or just type")
+	since := fs.StringP("since", "s", "", "only samples since <duration> ago (default 1h with --api, unless --from is given)")
+	from := fs.String("from", "", "only samples since <time> (RFC3339)")
+	to := fs.String("to", "", "only samples until <time> (RFC3339)")
+	asJSON := fs.BoolP("json", "j", false, "print JSON instead of a table")
+	err := fs.Parse(args)
+	if err != nil {
+		return 2
+	}
+	if (*apiAddr == "") == (*histFile == "") {
+		fmt.Fprintf(os.Stderr, "exactly one of --api or --file is required\n")
+		fs.Usage()
+		return 2
+	}
+
+	// a saved history may be old, show it whole
+	if *apiAddr != "" && *since == "" && *from == "" {
+		*since = defaultQuerySince
+	}
+
+	values := url.Values{}
+	values.Set("target", *target)
+	values.Set("metric", *metric)
+	values.Set("since", *since)
+	values.Set("from", *from)
+	values.Set("to", *to)
+	if *pid != 0 {
+		values.Set("pid", strconv.Itoa(*pid))
+	}
+	q, err := procapi.ParseQuery(values, time.Now())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 2
+	}
+
+	var items []procnotify.Sample
+	if *apiAddr != "" {
+		items, err = procapi.NewClient(*apiAddr, 10*time.Second).History(q)
+	} else {
+		items, err = procnotify.ReadHistory(*histFile)
+		if err == nil {
+			h := procnotify.NewHistory(len(items))
+			h.Add(items)
+			items = h.Query(q)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error querying the history: %s\n", err)
+		return 1
+	}
+
+	if *asJSON {
+		err = json.NewEncoder(os.Stdout).Encode(items)
+	} else {
+		err = printSamples(items)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+	return 0
+}
+
+func printSamples(items []procnotify.Sample) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "TIME\tTARGET\tPID\tIDENT\tMETRIC\tVALUE\n")
+	for _, item := range items {
+		pid := "-"
+		if item.Pid != 0 {
+			pid = strconv.Itoa(int(item.Pid))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", item.Time.Format(time.RFC3339),
+			item.Target, pid, item.Ident, item.Name, strconv.FormatFloat(item.Value, 'f', -1, 64))
+	}
+	return w.Flush()
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"github.com/fromanirh/procwatch/podfind"
+	"github.com/fromanirh/procwatch/procnotify"
+	"github.com/fromanirh/procwatch/procrec"
+	flag "github.com/spf13/pflag"
+
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// archiveConfName is where the configuration is stored in a recording.
+const archiveConfName = "config.json"
+
+// runRecord implements the record subcommand: save snapshots of the files
+// the targets of a configuration are collected from, to be replayed later.
+func runRecord(args []string) int {
+	fs := flag.NewFlagSet("record", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s record [options] /path/to/procwatch.json\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	output := fs.StringP("output", "o", "procwatch-record.tar.gz", "write the archive to <output>")
+	interval := fs.DurationP("interval", "d", 5*time.Second, "take a snapshot every <interval>")
+	count := fs.IntP("count", "c", 12, "take <count> snapshots")
+	err := fs.Parse(args)
+	if err != nil {
+		return 2
+	}
+	if fs.NArg() < 1 || *count < 1 || *interval <= 0 {
+		fs.Usage()
+		return 2
+	}
+
+	content, err := ioutil.ReadFile(fs.Arg(0))
+	conf := Config{}
+	if err == nil {
+		err = readFile(&conf, fs.Arg(0))
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error reading the configuration on '%s': %s\n", fs.Arg(0), err)
+		return 1
+	}
+	for _, target := range conf.Targets {
+		err = target.Validate()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid target configuration: %s\n", err)
+			return 1
+		}
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error getting the host name: %s\n", err)
+		return 1
+	}
+
+	var pr *podfind.PodResolver
+	if conf.CRIEndPoint != "" {
+		pr, err = podfind.NewPodResolver(conf.CRIEndPoint, 10*time.Second)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "pod resolution not available: %s\n", err)
+			pr = nil
+		}
+	}
+	// the Notifier only finds the processes to record, and collects nothing
+	notifier := procnotify.NewNotifier(conf.Targets, pr, "")
+	notifier.Output = ioutil.Discard
+
+	f, err := os.Create(*output)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error creating the archive: %s\n", err)
+		return 1
+	}
+	defer f.Close()
+	w := procrec.NewWriter(f)
+	err = w.AddFile(archiveConfName, content)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error writing the archive: %s\n", err)
+		return 1
+	}
+
+	tk := time.NewTicker(*interval)
+	defer tk.Stop()
+	for i := 0; i < *count; i++ {
+		if i > 0 {
+			<-tk.C
+		}
+		err = notifier.Rescan()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error scanning /proc: %s\n", err)
+		}
+		meta := procrec.Meta{
+			Time:     time.Now(),
+			Hostname: hostname,
+			Interval: *interval,
+		}
+		if pr != nil {
+			err = notifier.RefreshPods()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error listing the pods: %s\n", err)
+			}
+			l := pr.Listing()
+			meta.Pods = &l
+		}
+
+		var pids []int32
+		for _, target := range notifier.Status().Targets {
+			for _, proc := range target.Procs {
+				pids = append(pids, proc.Pid)
+			}
+		}
+		err = w.Snapshot(meta, pids)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error writing the archive: %s\n", err)
+			return 1
+		}
+		fmt.Fprintf(os.Stderr, "snapshot %d/%d: %d process(es)\n", i+1, *count, len(pids))
+	}
+
+	err = w.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error writing the archive: %s\n", err)
+		return 1
+	}
+	return 0
+}
+
+// runReplay implements the replay subcommand: run the collection against
+// the snapshots of a recording, as they were taken, and emit the output.
+func runReplay(args []string) int {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s replay [options] /path/to/archive.tar.gz\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	confPath := fs.StringP("config", "c", "", "use the configuration in <config>, not the recorded one")
+	sinkPath := fs.StringP("unixsock", "U", "", "send output to <unixsock> not to stdout")
+	err := fs.Parse(args)
+	if err != nil {
+		return 2
+	}
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return 2
+	}
+
+	dir, err := ioutil.TempDir("", "procwatch-replay")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error creating the work directory: %s\n", err)
+		return 1
+	}
+	defer os.RemoveAll(dir)
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error opening the archive: %s\n", err)
+		return 1
+	}
+	snaps, err := procrec.Extract(f, dir)
+	f.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error reading the archive: %s\n", err)
+		return 1
+	}
+	if len(snaps) == 0 {
+		fmt.Fprintf(os.Stderr, "no snapshots in the archive\n")
+		return 1
+	}
+
+	if *confPath == "" {
+		*confPath = filepath.Join(dir, archiveConfName)
+	}
+	conf := Config{}
+	err = readFile(&conf, *confPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error reading the configuration on '%s': %s\n", *confPath, err)
+		return 1
+	}
+	for _, target := range conf.Targets {
+		err = target.Validate()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid target configuration: %s\n", err)
+			return 1
+		}
+	}
+
+	replay(conf, snaps, *sinkPath, nil)
+	return 0
+}
+
+// replay runs the collection over the snapshots, one step each, like the
+// daemon does, at the time they were taken. The output goes to w if set,
+// to the sink otherwise.
+func replay(conf Config, snaps []procrec.Snapshot, sinkPath string, w io.Writer) {
+	var pr *podfind.PodResolver
+	if snaps[0].Pods != nil {
+		pr = podfind.NewStaticPodResolver(*snaps[0].Pods)
+	}
+
+	// the Notifier must see the recorded system from the start
+	restore := snaps[0].Use()
+	notifier := procnotify.NewNotifier(conf.Targets, pr, sinkPath)
+	notifier.Output = w
+	notifier.Schedule(snaps[0].Interval)
+	// the recorded times are long gone
+	notifier.Deadline = -1
+	restore()
+
+	for _, snap := range snaps {
+		restore := snap.Use()
+		if pr != nil && snap.Pods != nil {
+			pr.SetListing(*snap.Pods)
+		}
+		now := snap.Time
+		notifier.Clock = func() time.Time { return now }
+		err := notifier.Step(snap.Hostname)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error collecting the snapshot %s: %s\n", snap.Dir, err)
+		}
+		restore()
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"github.com/fromanirh/procwatch/cgroups"
+	"github.com/fromanirh/procwatch/procfs/procfstest"
+	"github.com/fromanirh/procwatch/procnotify"
+	"github.com/fromanirh/procwatch/procrec"
+
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func recordFakeProcFS(t *testing.T) []byte {
+	fs := procfstest.New(t)
+	defer fs.Remove()
+	defer fs.Use()()
+	oldRoot := cgroups.Root
+	cgroups.Root = filepath.Join(fs.Root, "cgroup")
+	defer func() { cgroups.Root = oldRoot }()
+
+	fs.Add(procfstest.Proc{Pid: 1, Argv: []string{"/usr/lib/systemd/systemd"}})
+	vdsm := procfstest.Proc{
+		Pid:       2159,
+		PPid:      1,
+		Argv:      []string{"/usr/bin/python2", "/usr/share/vdsm/vdsmd"},
+		StartTime: 5000,
+		RSS:       64 << 20,
+		Threads:   3,
+		FDs:       32,
+	}
+	fs.Add(vdsm)
+	fs.Add(procfstest.Proc{Pid: 2300, PPid: 2159, Argv: []string{"/usr/bin/dd", "if=/dev/zero"}, StartTime: 6000, RSS: 1 << 20, FDs: 3})
+
+	var buf bytes.Buffer
+	w := procrec.NewWriter(&buf)
+	meta := procrec.Meta{
+		Time:     time.Unix(1542710000, 0).UTC(),
+		Hostname: "node0",
+		Interval: 5 * time.Second,
+	}
+	for i := 0; i < 3; i++ {
+		err := w.Snapshot(meta, []int32{2159, 2300})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		meta.Time = meta.Time.Add(meta.Interval)
+		vdsm.UTime += 250
+		vdsm.RSS += 1 << 20
+		fs.Add(vdsm)
+	}
+	err := w.Close()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return buf.Bytes()
+}
+
+func replayArchive(t *testing.T, archive []byte, conf Config) []byte {
+	dir, err := ioutil.TempDir("", "procwatch-replay")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	snaps, err := procrec.Extract(bytes.NewReader(archive), dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var out bytes.Buffer
+	replay(conf, snaps, "", &out)
+	return out.Bytes()
+}
+
+func TestReplayDeterministic(t *testing.T) {
+	archive := recordFakeProcFS(t)
+	conf := Config{
+		Targets: []procnotify.Config{{
+			Name:            "vdsm",
+			Argv:            []string{"/usr/bin/python2", "/usr/share/vdsm/vdsm*"},
+			Metrics:         []string{procnotify.MetricsCPU, procnotify.MetricsMemory, procnotify.MetricsFDs},
+			IncludeChildren: true,
+		}},
+	}
+
+	first := replayArchive(t, archive, conf)
+	second := replayArchive(t, archive, conf)
+	if len(first) == 0 {
+		t.Fatalf("no output")
+	}
+	if !bytes.Equal(first, second) {
+		t.Errorf("mismatch:\nfirst\n%s\nsecond\n%s", first, second)
+	}
+	// the children are tracked like the daemon does
+	if !strings.Contains(string(first), "node0/exec-vdsm-dd_2300/") {
+		t.Errorf("child not collected:\n%s", first)
+	}
+	if !strings.Contains(string(first), "node0/exec-vdsm-2159/percent-cpu interval=5 1542710010.000:") {
+		t.Errorf("rates not replayed:\n%s", first)
+	}
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"github.com/fromanirh/procwatch/podfind"
+	"github.com/fromanirh/procwatch/proclog"
+	"github.com/fromanirh/procwatch/procnotify"
+	flag "github.com/spf13/pflag"
+
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+)
+
+// topMetrics are the groups needed to fill the columns of the view.
+var topMetrics = []string{
+	procnotify.MetricsCPU,
+	procnotify.MetricsMemory,
+	procnotify.MetricsSmaps,
+	procnotify.MetricsIO,
+	procnotify.MetricsFDs,
+	procnotify.MetricsThreads,
+	// tells the processes apart across PID reuse
+	procnotify.MetricsUptime,
+}
+
+type topRow struct {
+	target  string
+	pid     int32
+	pod     string
+	cpu     float64
+	rss     float64
+	pss     float64
+	read    float64
+	write   float64
+	fds     float64
+	threads float64
+}
+
+type topColumn struct {
+	key  byte
+	name string
+	less func(a, b topRow) bool
+}
+
+// topColumns are the columns of the view, and the keys to sort by them.
+// Text columns sort ascending, numeric ones descending.
+var topColumns = []topColumn{
+	{'t', "TARGET", func(a, b topRow) bool { return a.target < b.target }},
+	{'p', "PID", func(a, b topRow) bool { return a.pid < b.pid }},
+	{'n', "POD", func(a, b topRow) bool { return a.pod < b.pod }},
+	{'c', "CPU%", func(a, b topRow) bool { return a.cpu > b.cpu }},
+	{'r', "RSS", func(a, b topRow) bool { return a.rss > b.rss }},
+	{'s', "PSS", func(a, b topRow) bool { return a.pss > b.pss }},
+	{'i', "READ/s", func(a, b topRow) bool { return a.read > b.read }},
+	{'o', "WRITE/s", func(a, b topRow) bool { return a.write > b.write }},
+	{'f', "FDS", func(a, b topRow) bool { return a.fds > b.fds }},
+	{'h', "THR", func(a, b topRow) bool { return a.threads > b.threads }},
+}
+
+func findTopColumn(key byte) (topColumn, bool) {
+	for _, col := range topColumns {
+		if col.key == key {
+			return col, true
+		}
+	}
+	return topColumn{}, false
+}
+
+// ioCounter remembers the I/O totals of a process, to compute the rates.
+type ioCounter struct {
+	at      time.Time
+	started float64
+	read    float64
+	write   float64
+}
+
+// topView turns the status of the Notifier into rows.
+type topView struct {
+	prev map[int32]ioCounter
+}
+
+func (tv *topView) rows(st procnotify.Status) []topRow {
+	var rows []topRow
+	cur := make(map[int32]ioCounter)
+	for _, target := range st.Targets {
+		for _, proc := range target.Procs {
+			row := topRow{
+				target: target.Config.Name,
+				pid:    proc.Pid,
+				pod:    proc.Pod,
+			}
+			var io ioCounter
+			for _, item := range proc.Samples {
+				io.at = item.Time
+				switch item.Name {
+				case "percent-cpu":
+					row.cpu = item.Value
+				case "memory-resident":
+					row.rss = item.Value
+				case "memory-proportional":
+					row.pss = item.Value
+				case "total_bytes-read":
+					io.read = item.Value
+				case "total_bytes-write":
+					io.write = item.Value
+				case "file_handles-open":
+					row.fds = item.Value
+				case "threads":
+					row.threads = item.Value
+				case "gauge-start_time":
+					io.started = item.Value
+				}
+			}
+			// no rate for the first sample, nor across PID reuse
+			prev, ok := tv.prev[proc.Pid]
+			if ok && prev.started == io.started && io.at.After(prev.at) && io.read >= prev.read && io.write >= prev.write {
+				elapsed := io.at.Sub(prev.at).Seconds()
+				row.read = (io.read - prev.read) / elapsed
+				row.write = (io.write - prev.write) / elapsed
+			}
+			cur[proc.Pid] = io
+			rows = append(rows, row)
+		}
+	}
+	tv.prev = cur
+	return rows
+}
+
+// formatKiB formats a size given in KiB, as the memory metrics are.
+func formatKiB(v float64) string {
+	units := []string{"K", "M", "G", "T"}
+	idx := 0
+	for v >= 1024 && idx < len(units)-1 {
+		v /= 1024
+		idx++
+	}
+	return fmt.Sprintf("%.1f%s", v, units[idx])
+}
+
+func renderTop(w io.Writer, rows []topRow, col topColumn, now time.Time) {
+	sort.SliceStable(rows, func(i, j int) bool { return col.less(rows[i], rows[j]) })
+
+	var keys []string
+	for _, c := range topColumns {
+		keys = append(keys, fmt.Sprintf("%c=%s", c.key, strings.ToLower(c.name)))
+	}
+	fmt.Fprintf(w, "procwatch top - %s - %d process(es), sorted by %s\n", now.Format("15:04:05"), len(rows), col.name)
+	fmt.Fprintf(w, "sort: %s, q=quit\n\n", strings.Join(keys, " "))
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	var names []string
+	for _, c := range topColumns {
+		names = append(names, c.name)
+	}
+	fmt.Fprintf(tw, "%s\t\n", strings.Join(names, "\t"))
+	for _, row := range rows {
+		pod := row.pod
+		if pod == "" {
+			pod = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%.1f\t%s\t%s\t%s\t%s\t%.0f\t%.0f\t\n",
+			row.target, row.pid, pod, row.cpu, formatKiB(row.rss), formatKiB(row.pss),
+			formatKiB(row.read/1024), formatKiB(row.write/1024), row.fds, row.threads)
+	}
+	tw.Flush()
+}
+
+// runTop implements the top subcommand: a live view of the processes
+// of the targets, collected like the daemon does.
+func runTop(args []string) int {
+	fs := flag.NewFlagSet("top", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s top [options] /path/to/procwatch.json\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	interval := fs.DurationP("interval", "d", 2*time.Second, "refresh every <interval>")
+	iterations := fs.IntP("iterations", "n", 0, "exit after <iterations> refreshes, 0 means forever")
+	sortKey := fs.StringP("sort", "s", "c", "sort by the column of <key>, see the help line")
+	batch := fs.BoolP("batch", "b", false, "don't clear the screen, don't read commands")
+	err := fs.Parse(args)
+	if err != nil {
+		return 2
+	}
+	if fs.NArg() < 1 || *interval <= 0 {
+		fs.Usage()
+		return 2
+	}
+	var col topColumn
+	ok := false
+	if *sortKey != "" {
+		col, ok = findTopColumn((*sortKey)[0])
+	}
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown sort key: %q\n", *sortKey)
+		return 2
+	}
+
+	conf := Config{}
+	err = readFile(&conf, fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error reading the configuration on '%s': %s\n", fs.Arg(0), err)
+		return 1
+	}
+	var targets []procnotify.Config
+	for _, target := range conf.Targets {
+		err = target.Validate()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid target configuration: %s\n", err)
+			return 1
+		}
+		// only what the view needs, at the pace of the view
+		targets = append(targets, procnotify.Config{
+			Name:               target.Name,
+			Argv:               target.Argv,
+			Metrics:            topMetrics,
+			IncludeChildren:    target.IncludeChildren,
+			IncludeDescendants: target.IncludeDescendants,
+		})
+	}
+
+	var pr *podfind.PodResolver
+	if conf.CRIEndPoint != "" {
+		pr, err = podfind.NewPodResolver(conf.CRIEndPoint, 10*time.Second)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "pod resolution not available: %s\n", err)
+			pr = nil
+		}
+	}
+
+	// the log would mess up the screen
+	proclog.Setup(proclog.Config{}, ioutil.Discard)
+	notifier := procnotify.NewNotifier(targets, pr, "")
+	batches := notifier.Subscribe(context.Background(), "localhost", *interval, true)
+
+	commands := make(chan byte)
+	signals := make(chan os.Signal, 1)
+	if !*batch {
+		restore, err := cbreakMode()
+		if err != nil {
+			// not a terminal: the commands come a line at a time
+			restore = func() {}
+		}
+		defer restore()
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		defer signal.Stop(signals)
+		go readCommands(os.Stdin, commands)
+	}
+
+	tv := &topView{}
+	var rows []topRow
+	for count := 0; ; {
+		select {
+		case _, ok := <-batches:
+			if !ok {
+				return 0
+			}
+			rows = tv.rows(notifier.Status())
+			count++
+		case <-signals:
+			return 0
+		case key := <-commands:
+			if key == 'q' {
+				return 0
+			}
+			if c, ok := findTopColumn(key); ok {
+				col = c
+			}
+		}
+		if !*batch {
+			fmt.Print("\033[H\033[2J")
+		}
+		renderTop(os.Stdout, rows, col, time.Now())
+		if *iterations > 0 && count >= *iterations {
+			return 0
+		}
+	}
+}
+
+// cbreakMode makes the terminal deliver the keys as soon as they are
+// pressed, without echoing them. The returned function restores it.
+func cbreakMode() (func(), error) {
+	stty := func(args ...string) ([]byte, error) {
+		cmd := exec.Command("stty", args...)
+		cmd.Stdin = os.Stdin
+		return cmd.Output()
+	}
+	saved, err := stty("-g")
+	if err != nil {
+		return nil, err
+	}
+	_, err = stty("-icanon", "-echo", "min", "1")
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		stty(strings.TrimSpace(string(saved)))
+	}, nil
+}
+
+// readCommands sends the keys read from r, skipping the blanks.
+func readCommands(r io.Reader, commands chan<- byte) {
+	br := bufio.NewReader(r)
+	for {
+		key, err := br.ReadByte()
+		if err != nil {
+			return
+		}
+		if key == ' ' || key == '\t' || key == '\r' || key == '\n' {
+			continue
+		}
+		commands <- key
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"github.com/fromanirh/procwatch/procnotify"
+
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func topStatus(at time.Time, pid int32, started, read, write float64) procnotify.Status {
+	sample := func(name string, value float64) procnotify.Sample {
+		return procnotify.Sample{Pid: pid, Name: name, Time: at, Value: value}
+	}
+	return procnotify.Status{
+		Targets: []procnotify.TargetStatus{{
+			Config: procnotify.Config{Name: "vdsm"},
+			Procs: []procnotify.ProcStatus{{
+				Pid: pid,
+				Samples: []procnotify.Sample{
+					sample("percent-cpu", 12.5),
+					sample("total_bytes-read", read),
+					sample("total_bytes-write", write),
+					sample("gauge-start_time", started),
+				},
+			}},
+		}},
+	}
+}
+
+func TestTopViewRates(t *testing.T) {
+	at := time.Unix(1542710000, 0)
+	tv := &topView{}
+
+	rows := tv.rows(topStatus(at, 2159, 5000, 1000, 2000))
+	if len(rows) != 1 || rows[0].cpu != 12.5 || rows[0].read != 0 || rows[0].write != 0 {
+		t.Fatalf("mismatch: first rows %+v", rows)
+	}
+
+	at = at.Add(2 * time.Second)
+	rows = tv.rows(topStatus(at, 2159, 5000, 5000, 3000))
+	if len(rows) != 1 || rows[0].read != 2000 || rows[0].write != 500 {
+		t.Errorf("mismatch: rates %+v", rows)
+	}
+
+	// no new sample, no rate
+	rows = tv.rows(topStatus(at, 2159, 5000, 5000, 3000))
+	if len(rows) != 1 || rows[0].read != 0 || rows[0].write != 0 {
+		t.Errorf("mismatch: stale rates %+v", rows)
+	}
+}
+
+func TestTopViewPIDReuse(t *testing.T) {
+	at := time.Unix(1542710000, 0)
+	tv := &topView{}
+
+	tv.rows(topStatus(at, 2159, 5000, 1000, 2000))
+	// same pid, another process: its counters start over
+	at = at.Add(2 * time.Second)
+	rows := tv.rows(topStatus(at, 2159, 7000, 3000, 4000))
+	if len(rows) != 1 || rows[0].read != 0 || rows[0].write != 0 {
+		t.Errorf("mismatch: rates across PID reuse %+v", rows)
+	}
+
+	at = at.Add(2 * time.Second)
+	rows = tv.rows(topStatus(at, 2159, 7000, 5000, 4000))
+	if len(rows) != 1 || rows[0].read != 1000 || rows[0].write != 0 {
+		t.Errorf("mismatch: rates after PID reuse %+v", rows)
+	}
+}
+
+func TestTopSort(t *testing.T) {
+	rows := []topRow{
+		{target: "vdsm", pid: 2159, cpu: 1, rss: 300},
+		{target: "qemu", pid: 2192, cpu: 30, rss: 100},
+		{target: "httpd", pid: 2300, cpu: 10, rss: 200},
+	}
+	expected := map[byte][]int32{
+		't': {2300, 2192, 2159},
+		'p': {2159, 2192, 2300},
+		'c': {2192, 2300, 2159},
+		'r': {2159, 2300, 2192},
+	}
+	for key, pids := range expected {
+		col, ok := findTopColumn(key)
+		if !ok {
+			t.Fatalf("missing column for %c", key)
+		}
+		var buf bytes.Buffer
+		renderTop(&buf, rows, col, time.Unix(1542710000, 0))
+		for i, pid := range pids {
+			if rows[i].pid != pid {
+				t.Errorf("mismatch sorting by %c: %+v", key, rows)
+				break
+			}
+		}
+		if !strings.Contains(buf.String(), "sorted by "+col.name) {
+			t.Errorf("mismatch: header\n%s", buf.String())
+		}
+	}
+
+	if _, ok := findTopColumn('x'); ok {
+		t.Errorf("unexpected column for x")
+	}
+}
+
+func TestReadCommands(t *testing.T) {
+	commands := make(chan byte)
+	go readCommands(strings.NewReader("r\n c q"), commands)
+	var keys []byte
+	for i := 0; i < 3; i++ {
+		keys = append(keys, <-commands)
+	}
+	if string(keys) != "rcq" {
+		t.Errorf("mismatch: %q", keys)
+	}
+}
+
+func TestTopInvalidInterval(t *testing.T) {
+	for _, interval := range []string{"0", "-1s"} {
+		ret := runTop([]string{"--interval=" + interval, "/nonexistent/procwatch.json"})
+		if ret != 2 {
+			t.Errorf("mismatch: interval %s exit code %d expected 2", interval, ret)
+		}
+	}
+}